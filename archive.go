@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archivePath, if set, is a .tar, .tar.gz, .tgz or .zip file the built
+// package's static directory is packed into after the build.
+var archivePath = ""
+
+// archiveTime is the modification time of every archive entry, so that the
+// same outputs always make the same archive; zip can't go before 1980.
+var archiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveFormat returns "tar", "tar.gz" or "zip" for the archive name, by
+// its extension.
+func archiveFormat(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("--archive must end in .tar, .tar.gz, .tgz or .zip, got %s", name)
+}
+
+// archivedFiles returns the files under the static directory root that go
+// in the archive, relative to it, slash separated and in path order; the
+// build's own bookkeeping, and the archive itself, are left out.
+func archivedFiles(root string, archive string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if strings.HasPrefix(name, ".seven5-") {
+				return filepath.SkipDir //an interrupted compile's scratch
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || path == archive || strings.HasPrefix(name, ".seven5-") {
+			return nil
+		}
+		if filepath.Dir(path) == root && (name == manifestName || isCacheFile(name)) {
+			return nil
+		}
+		files = append(files, filepath.ToSlash(relativePath(root, path)))
+		return nil
+	})
+	return files, err
+}
+
+// writeArchive packs arg's static directory into name. Entries are in
+// path order with fixed times, modes and owners, so the archive is
+// byte-identical whenever the outputs are. It is written beside name and
+// renamed into place, as the outputs are.
+func writeArchive(project string, arg string, name string) error {
+	format, err := archiveFormat(name)
+	if err != nil {
+		return err
+	}
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	root := constructStaticPath(project, arg)
+	files, err := archivedFiles(root, name)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".seven5-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	switch format {
+	case "zip":
+		err = writeZip(tmp, root, files)
+	case "tar.gz":
+		gz, _ := gzip.NewWriterLevel(tmp, gzip.BestCompression)
+		if err = writeTar(gz, root, files); err == nil {
+			err = gz.Close()
+		}
+	default:
+		err = writeTar(tmp, root, files)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	logf(os.Stdout, "gb seven5: archived %d files to %s\n", len(files), name)
+	return nil
+}
+
+func writeTar(w io.Writer, root string, files []string) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  archiveTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, root string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: file, Method: zip.Deflate, Modified: archiveTime}
+		header.SetMode(0644)
+		//already compressed outputs aren't worth deflating again
+		if strings.HasSuffix(file, ".gz") {
+			header.Method = zip.Store
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// buildProfile names the preset of buildProfiles to apply, if any.
+var buildProfile = ""
+
+// buildProfiles are the --profile presets: the value each gives the flags
+// it covers, by name. A flag given on the command line keeps its value.
+var buildProfiles = map[string]map[string]bool{
+	"dev":  {"dev": true, "minify-html": false, "fingerprint": false, "compress": false},
+	"prod": {"dev": false, "minify-html": true, "fingerprint": true, "compress": true},
+}
+
+// applyBuildProfile sets the flags of the --profile preset that weren't
+// given explicitly.
+func applyBuildProfile(flags *flag.FlagSet) error {
+	if buildProfile == "" {
+		return nil
+	}
+	preset, ok := buildProfiles[buildProfile]
+	if !ok {
+		names := []string{}
+		for name := range buildProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("--profile must be one of %s, got %q", strings.Join(names, ", "), buildProfile)
+	}
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range preset {
+		if given[name] {
+			continue
+		}
+		if err := flags.Set(name, strconv.FormatBool(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// changedSince, if set, is a git revision; only the packages with changes
+// since it are built.
+var changedSince = ""
+
+// changedPackages returns those of args that have changed since ref, by
+// git diff run in the project. A file in a package marks it changed. A go
+// file elsewhere in the project's or vendor's source trees marks the
+// packages whose client code imports its package, and any other file,
+// e.g. seven5.json, may affect them all. Without git, or if git fails,
+// every package is built, as it would be without --changed-since.
+func changedPackages(project string, args []string, ref string) []string {
+	files, err := gitChangedFiles(project, ref)
+	if err != nil {
+		logAt(os.Stderr, severityWarning, "gb seven5: warning: unable to find the changes since %s (%v), building every package\n", ref, err)
+		return args
+	}
+	changed := map[string]bool{}
+	libraries := []string{} //changed go files outside the packages
+	for _, file := range files {
+		if arg := owningPackage(args, file); arg != "" {
+			changed[arg] = true
+			continue
+		}
+		inSource := strings.HasPrefix(file, sourceDir+"/") || strings.HasPrefix(file, "vendor/"+sourceDir+"/")
+		if !inSource || !strings.HasSuffix(file, ".go") {
+			logf(os.Stdout, "gb seven5: %s changed, which may affect any package, building every package\n", file)
+			return args
+		}
+		libraries = append(libraries, filepath.Join(project, filepath.FromSlash(file)))
+	}
+	for _, arg := range args {
+		if changed[arg] || len(libraries) == 0 {
+			continue
+		}
+		imports, err := importsAnyOf(project, arg, libraries)
+		if err != nil {
+			logAt(os.Stderr, severityWarning, "gb seven5: warning: unable to find what %s imports (%v), building every package\n", arg, err)
+			return args
+		}
+		changed[arg] = imports
+	}
+	result := []string{}
+	for _, arg := range args {
+		if changed[arg] {
+			result = append(result, arg)
+		}
+	}
+	logf(os.Stdout, "gb seven5: %d of %d packages changed since %s\n", len(result), len(args), ref)
+	return result
+}
+
+// gitChangedFiles returns the files, relative to the project and slash
+// separated, that differ between ref and the working tree.
+func gitChangedFiles(project string, ref string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-C", project, "diff", "--name-only", "--relative", ref, "--"}
+	if err := runWithTimeout(buildContext, "git", args, nil, nil, &stdout, &stderr); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	files := []string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// owningPackage returns the one of args whose directory file, relative to
+// the project, is in; the innermost, if they nest.
+func owningPackage(args []string, file string) string {
+	owner := ""
+	for _, arg := range args {
+		prefix := sourceDir + "/" + filepath.ToSlash(arg) + "/"
+		if strings.HasPrefix(file, prefix) && len(arg) > len(owner) {
+			owner = arg
+		}
+	}
+	return owner
+}
+
+// importsAnyOf reports whether the client code of arg, or the common
+// package compiled with it, imports, directly or not, the package of any of
+// files.
+func importsAnyOf(project string, arg string, files []string) (bool, error) {
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return false, err
+	}
+	dirs := map[string]bool{}
+	if config.CommonPackage != "" {
+		dir, err := commonPackageDir(project)
+		if err != nil {
+			return false, err
+		}
+		dirs[dir] = true
+		common, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			return false, err
+		}
+		gofiles = append(gofiles, common...)
+	}
+	for _, gofile := range gofiles {
+		if err := collectImportDirs(project, gofile, dirs); err != nil {
+			return false, err
+		}
+	}
+	for _, file := range files {
+		if dirs[filepath.Dir(file)] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+)
+
+// checkPackages validates the layout, page data and client sources of each
+// package in args without running gopherjs or pagegen. Every problem found
+// is reported, rather than stopping at the first, and any problem makes the
+// check fail.
+func checkPackages(project string, args []string) error {
+	if len(args) == 0 {
+		help()
+		return nil
+	}
+	problems := 0
+	for _, arg := range args {
+		for _, err := range checkPackage(project, arg) {
+			logError(arg, err)
+			problems++
+		}
+	}
+	if problems == 0 {
+		logAt(os.Stdout, severityDone, "gb seven5: no problems found\n")
+		return nil
+	}
+	err := fmt.Errorf("%d problems found", problems)
+	logf(os.Stderr, "gb seven5: %v\n", err)
+	return err
+}
+
+func checkPackage(project string, arg string) []error {
+	//nothing else can be checked without the expected directories
+	if err := validateProjectStructure(project, arg); err != nil {
+		return []error{err}
+	}
+	errs := checkPageData(project, arg)
+	if failOnOrphanHTML {
+		//a data file problem is reported above, and may hide the pairs
+		if jsonFiles, htmlFiles, err := findTemplates(project, arg); err == nil {
+			errs = append(errs, orphanTemplates(project, arg, jsonFiles, htmlFiles)...)
+		}
+	}
+	return append(errs, checkClientSources(project, arg)...)
+}
+
+// checkPageData confirms that every data file, and all front matter, in
+// the template roots parses, and that each data file that is not a locale
+// overlay has an html template.
+func checkPageData(project string, arg string) []error {
+	errs := []error{}
+	seen := map[string]bool{}
+	roots := constructTemplateRoots(project, arg)
+	for _, templatePath := range roots {
+		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
+			continue
+		}
+		errs = append(errs, checkTemplateRoot(templatePath, roots, ignoresFor(project, arg), seen)...)
+	}
+	return errs
+}
+
+// checkTemplateRoot checks the data files and front matter of one of the
+// template roots; clashes already in seen aren't reported again.
+func checkTemplateRoot(templatePath string, roots []string, ignore *ignoreRules, seen map[string]bool) []error {
+	errs := []error{}
+	err := walkTree(templatePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := ignore.skip(path, info); skip {
+			return err
+		}
+		if info.IsDir() && (info.Name() == config.Layout.SupportDir || path == filepath.Join(templatePath, config.Layout.SupportDir)) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".html" && hasFrontMatter(path) {
+			if _, err := readDataFile(path); err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+		if info.IsDir() || !isDataFile(info.Name()) {
+			return nil
+		}
+		//a clashing pair is seen from both of its files, report it once
+		if err := checkSingleDataFile(path); err != nil && !seen[err.Error()] {
+			seen[err.Error()] = true
+			errs = append(errs, err)
+		}
+		if _, err := readDataFile(path); err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if isOverlay(path) {
+			return nil
+		}
+		if _, err := templateFor(roots, path); err != nil && err != errNoTemplate {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// checkClientSources confirms that every go file in the client package
+// parses, reporting each syntax error with its position.
+func checkClientSources(project string, arg string) []error {
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	for _, gofile := range gofiles {
+		_, err := parser.ParseFile(token.NewFileSet(), gofile, nil, parser.AllErrors)
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				errs = append(errs, e)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
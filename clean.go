@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cleanPackages removes the compiled javascript and generated html of each
+// package in args. The files listed in the build manifest are removed; if
+// there is no manifest, only files that correspond to a page or template
+// that still exists in source are. Either way hand-authored static assets
+// are left alone.
+func cleanPackages(project string, args []string) error {
+	if len(args) == 0 {
+		help()
+		return nil
+	}
+	errs := []error{}
+	for _, arg := range args {
+		if err := cleanPackage(project, arg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", arg, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		logf(os.Stderr, "gb seven5: %v\n", err)
+	}
+	return fmt.Errorf("unable to clean %d of %d packages", len(errs), len(args))
+}
+
+func cleanPackage(project string, arg string) error {
+	if err := validateProjectStructure(project, arg); err != nil {
+		return err
+	}
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return err
+	}
+	targets, err := manifestOutputs(project, arg)
+	if os.IsNotExist(err) {
+		targets = nil
+		err = forEachLanguage(langs, func(lang string) error {
+			generated, err := generatedFiles(project, arg, lang)
+			targets = append(targets, generated...)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	targets = append(targets, constructManifestPath(project, arg))
+	forEachLanguage(langs, func(lang string) error {
+		targets = append(targets, pageCachePathFor(project, arg, lang), optionsCachePathFor(project, arg, lang))
+		return nil
+	})
+	for _, target := range targets {
+		err := os.Remove(target)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logAt(os.Stdout, severityDone, "gb seven5: removed %s\n", target)
+	}
+	return nil
+}
+
+// manifestOutputs returns the output paths recorded in arg's build manifest.
+func manifestOutputs(project string, arg string) ([]string, error) {
+	entries, err := readManifest(project, arg)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{}
+	for _, entry := range entries {
+		targets = append(targets, filepath.Join(project, filepath.FromSlash(entry.Output)))
+		if entry.Step == "gopherjs" {
+			targets = append(targets, filepath.Join(project, filepath.FromSlash(entry.Output))+".map")
+		}
+	}
+	return targets, nil
+}
+
+// generatedFiles returns the output paths a build of arg would produce,
+// based on the pages and templates currently in its source tree.
+func generatedFiles(project string, arg string, lang string) ([]string, error) {
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return nil, err
+	}
+	pages, err := findPages(gofiles)
+	if err != nil {
+		return nil, err
+	}
+	jsonFiles, _, err := findTemplates(project, arg)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{}
+	for _, page := range pages {
+		//gopherjs writes a source map next to the javascript
+		js := jsTarget(project, arg, lang, page)
+		targets = append(targets, js, js+".map")
+	}
+	for _, json := range jsonFiles {
+		targets = append(targets, pageTarget(project, arg, lang, json))
+	}
+	return targets, nil
+}
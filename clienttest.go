@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// testArgs are the arguments after -- on the command line, passed on to
+// gopherjs test, e.g. -run TestCart -v.
+var testArgs []string
+
+// splitTestArgs separates args at the first --, which flag parsing would
+// otherwise swallow.
+func splitTestArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// testPackages runs the client tests of each package in args with gopherjs
+// test, continuing past failures so every failing package is reported.
+func testPackages(project string, args []string) error {
+	if len(args) == 0 {
+		help()
+		return nil
+	}
+	if err := validateExecutable(project, "gopherjs"); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	failures := 0
+	for _, arg := range args {
+		if err := testPackage(project, arg); err != nil {
+			logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+			failures++
+		}
+		if buildContext.Err() != nil {
+			return errInterrupted
+		}
+	}
+	if failures == 0 {
+		return nil
+	}
+	err := fmt.Errorf("tests failed in %d of %d packages", failures, len(args))
+	logf(os.Stderr, "gb seven5: %v\n", err)
+	return err
+}
+
+// testPackage runs gopherjs test, with the project's GOPATH, on every
+// package in arg's client tree that has tests. Its errors are left to
+// testPackages to log.
+func testPackage(project string, arg string) error {
+	if err := validatePackageSpec(project, arg); err != nil {
+		return err
+	}
+	if err := validateClientPackage(project, arg); err != nil {
+		return fmt.Errorf("unable to find client package in %s (client_dir in %s)",
+			constructClientPackagePath(project, arg), configName)
+	}
+	packages, err := testedPackages(project, constructClientPackagePath(project, arg))
+	if err != nil {
+		return err
+	}
+	if len(packages) == 0 {
+		logf(os.Stdout, "gb seven5: no client tests in %s\n", arg)
+		return nil
+	}
+	args := []string{"test"}
+	if buildTags := strings.Fields(tags); len(buildTags) > 0 {
+		args = append(args, "-tags", strings.Join(buildTags, " "))
+	}
+	args = append(append(args, testArgs...), packages...)
+	return runGopherjs(buildContext, project, arg+" test", args...)
+}
+
+// testedPackages returns the import path of each package under dir that has
+// a _test.go file, in order.
+func testedPackages(project string, dir string) ([]string, error) {
+	found := map[string]bool{}
+	err := walkTree(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != dir && (info.Name() == "vendor" || info.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), "_test.go") {
+			found[filepath.ToSlash(relativePath(constructSourcePath(project), filepath.Dir(path)))] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %v", dir, err)
+	}
+	packages := []string{}
+	for pkg := range found {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// runGopherjs runs gopherjs once, with the project's GOPATH as for a build,
+// streaming its output prefixed with name. Unlike launchGopherjs it never
+// retries, since a failed test fails the same way again.
+func runGopherjs(ctx context.Context, projectDir string, name string, args ...string) error {
+	gopath := gopherjsPath(projectDir)
+	if dryRun {
+		logAt(os.Stdout, severityCommand, "gb seven5: would run GOPATH=%s %s\n", gopath, commandLine(toolPath("gopherjs"), args))
+		return nil
+	}
+	env := gopherjsEnv(projectDir)
+	stdout := newLineWriter(os.Stdout, name)
+	stderr := newLineWriter(os.Stderr, name)
+	err := runWithTimeout(ctx, toolPath("gopherjs"), args, env, nil, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTestPackagesLogsOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"bad spec", "../site", "gb seven5: ../site: package ../site must not contain '..'\n"},
+		{"no client dir", "bare", "gb seven5: bare: unable to find client package in "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFakeRunner(t)
+			withTools(t)
+			project := newTestProject(t, "site")
+			writeFiles(t, filepath.Join(project, "src", "bare"), map[string]string{"static/en/web/.k": ""})
+			var err error
+			output := captureOutput(t, &os.Stderr, func() {
+				err = testPackages(project, []string{test.arg})
+			})
+			if err == nil {
+				t.Fatal("tested a broken package without an error")
+			}
+			if got := strings.Count(output, test.want); got != 1 {
+				t.Errorf("logged %q, want %q once, got it %d times", output, test.want, got)
+			}
+			if got := strings.Count(output, "\n"); got != 2 {
+				t.Errorf("logged %q, want the package's error and the summary", output)
+			}
+		})
+	}
+}
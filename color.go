@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorDim    = "\x1b[2m"
+)
+
+// severity says how a human format message is colored: commands dimmed,
+// skips and warnings yellow, work done green and errors red.
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityCommand
+	severitySkipped
+	severityWarning
+	severityDone
+	severityError
+)
+
+var severityColors = map[severity]string{
+	severityCommand: colorDim,
+	severitySkipped: colorYellow,
+	severityWarning: colorYellow,
+	severityDone:    colorGreen,
+	severityError:   colorRed,
+}
+
+// streamSeverity is the severity of a message logf writes to w: an error
+// on stderr, otherwise nothing to color.
+func streamSeverity(w io.Writer) severity {
+	if w == os.Stderr {
+		return severityError
+	}
+	return severityInfo
+}
+
+var (
+	terminalOnce   sync.Once
+	stdoutTerminal bool
+	stderrTerminal bool
+)
+
+// colorize wraps message, printed to w, in the color for sev if w is a
+// terminal. NO_COLOR (see no-color.org) or TERM=dumb turn color off.
+func colorize(w io.Writer, sev severity, message string) string {
+	terminalOnce.Do(func() {
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return
+		}
+		stdoutTerminal = isTerminal(os.Stdout)
+		stderrTerminal = isTerminal(os.Stderr)
+	})
+	terminal := false
+	switch w {
+	case os.Stderr:
+		terminal = stderrTerminal
+	case os.Stdout:
+		terminal = stdoutTerminal
+	}
+	color := severityColors[sev]
+	if !terminal || color == "" {
+		return message
+	}
+	//keep the newline outside so a line is never left colored
+	body := strings.TrimSuffix(message, "\n")
+	return color + body + colorReset + message[len(body):]
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// commonScriptName is the base name, before the js extension, of the
+// script the common package is compiled to.
+const commonScriptName = "common"
+
+// commonTarget returns the script the common package is compiled to for
+// arg's lang: common.js in the js directory, named for the language as
+// pages are.
+func commonTarget(project string, arg string, lang string) string {
+	name := languageSuffix(commonScriptName+config.JSExtension, lang)
+	return filepath.Join(constructWebPath(project, arg, lang), config.JSDir, name)
+}
+
+// commonPackageDir returns the directory of the common package, in the
+// project's source tree or the vendor one.
+func commonPackageDir(project string) (string, error) {
+	for _, root := range []string{project, filepath.Join(project, "vendor")} {
+		dir := filepath.Join(constructSourcePath(root), filepath.FromSlash(config.CommonPackage))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("common_package: no package %s in %s or vendor", config.CommonPackage, constructSourcePath(project))
+}
+
+func validateCommonPackage(importPath string) error {
+	if importPath == "" {
+		return nil
+	}
+	if path.IsAbs(importPath) || strings.Contains(importPath, `\`) || path.Clean(importPath) != importPath ||
+		importPath == ".." || strings.HasPrefix(importPath, "../") {
+		return fmt.Errorf("common_package: must be an import path, e.g. site/widgets, got %q", importPath)
+	}
+	return nil
+}
+
+// compileCommon compiles the common package on its own into target, by way
+// of a generated main package that does nothing but import it.
+//
+// gopherjs can't split a program into scripts that share code, so this is
+// no help to a page that imports the common package: its script still gets
+// a copy. What the common script is for is code pages reach through the
+// javascript globals the common package sets up when it is initialized,
+// e.g. in its init with js.Global.Set, instead of importing it. A template
+// loads it with a script element before the page's own, as it would any
+// other script; fingerprinting, inlining and the suffix language layout
+// treat it as one of the page scripts.
+func compileCommon(project string, arg string, target string) error {
+	dir, err := ioutil.TempDir("", "seven5-common-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	wrapper := filepath.Join(dir, commonScriptName+".go")
+	source := fmt.Sprintf("package main\n\nimport _ %q\n\nfunc main() {}\n", config.CommonPackage)
+	if err := ioutil.WriteFile(wrapper, []byte(source), 0644); err != nil {
+		return err
+	}
+	return compileScript(project, config.CommonPackage, wrapper, target, pageOptions{})
+}
+
+// commonUpToDate reports whether target, the common script, is newer than
+// the common package and everything it imports from the source trees.
+func commonUpToDate(project string, dir string, target string) bool {
+	info, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	gofiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return false
+	}
+	dirs := map[string]bool{dir: true}
+	for _, gofile := range gofiles {
+		if err := collectImportDirs(project, gofile, dirs); err != nil {
+			return false
+		}
+	}
+	for dir := range dirs {
+		if anyDirectoryContentAfter(dir, info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	commonImporters     = map[string]bool{}
+	commonImportersLock sync.Mutex
+)
+
+// noteIfImportsCommon notes page if it imports the common package, in
+// dir, for warnCommonImports.
+func noteIfImportsCommon(project string, page string, dir string) {
+	dirs := map[string]bool{}
+	for _, source := range pageSources(page) {
+		if err := collectImportDirs(project, source, dirs); err != nil {
+			return //the compile reports it
+		}
+	}
+	if dirs[dir] {
+		commonImportersLock.Lock()
+		defer commonImportersLock.Unlock()
+		commonImporters[projectRelative(project, page)] = true
+	}
+}
+
+// warnCommonImports warns, once for the build, that the pages noted since
+// the last build have their own copy of the common package.
+func warnCommonImports() {
+	commonImportersLock.Lock()
+	defer commonImportersLock.Unlock()
+	if len(commonImporters) == 0 {
+		return
+	}
+	pages := []string{}
+	for page := range commonImporters {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	commonImporters = map[string]bool{}
+	logAt(os.Stderr, severityWarning, "gb seven5: warning: %s import the common package %s, so each script has its own copy of it\n",
+		strings.Join(pages, ", "), config.CommonPackage)
+}
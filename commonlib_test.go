@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunWarnsOnceAboutCommonImports(t *testing.T) {
+	useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "one", "two")
+	page := "package main\n\nimport _ \"widgets\"\n\nfunc main() {}\n"
+	writeFiles(t, project, map[string]string{
+		configName:                  `{"common_package": "widgets"}`,
+		"src/widgets/widgets.go":    "package widgets\n",
+		"src/one/client/about.go":   page,
+		"src/one/client/contact.go": page,
+		"src/two/client/about.go":   page,
+	})
+	var err error
+	out := captureOutput(t, &os.Stderr, func() { err = run(project, []string{"one", "two"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out, "import the common package widgets"); n != 1 {
+		t.Fatalf("warned %d times about importing the common package:\n%s", n, out)
+	}
+	for _, page := range []string{"src/one/client/about.go", "src/one/client/contact.go", "src/two/client/about.go"} {
+		if !strings.Contains(out, page) {
+			t.Errorf("the warning doesn't name %s:\n%s", page, out)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressMinSize is the smallest output worth precompressing; below it
+// the gzip header and a round trip to the CDN outweigh the saving.
+const compressMinSize = 1024
+
+// compressOutputs writes a .gz sibling for each javascript and html file
+// the build of arg produced, so a server can send it precompressed. Files
+// smaller than compressMinSize, or that gzip would make larger, get none.
+func compressOutputs(project string, arg string) error {
+	manifest := manifestFor(project, arg)
+	for _, entry := range manifest.sorted() {
+		if entry.Step == "gzip" {
+			continue
+		}
+		if !strings.HasSuffix(entry.Output, config.JSExtension) && !strings.HasSuffix(entry.Output, ".html") {
+			continue
+		}
+		output := filepath.Join(project, filepath.FromSlash(entry.Output))
+		compressed := output + ".gz"
+		if !force && !fileAfter(output, modTime(compressed)) {
+			manifest.record("gzip", output, compressed)
+			continue
+		}
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if len(data) >= compressMinSize {
+			w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+			w.Write(data)
+			if err := w.Close(); err != nil {
+				return err
+			}
+		}
+		//a stale .gz would be served in place of the new output
+		if buf.Len() == 0 || buf.Len() >= len(data) {
+			if err := os.Remove(compressed); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := writeFileAtomic(compressed, buf.Bytes()); err != nil {
+			return err
+		}
+		manifest.record("gzip", output, compressed)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const configName = "seven5.json"
+
+// sourceDir is where a project keeps its packages, as gb requires, so it
+// is the one directory name that isn't part of the Layout.
+const sourceDir = "src"
+
+// Layout holds the names of the directories within a package that the
+// tool reads from and writes to. They are relative to the package, i.e.
+// to src/<package>, and every construct*Path helper is built on them.
+type Layout struct {
+	ClientDir  string `json:"client_dir"`
+	PagesDir   string `json:"pages_dir"`
+	SupportDir string `json:"support_dir"` //pagegen includes, relative to PagesDir
+	StaticDir  string `json:"static_dir"`
+	WebDir     string `json:"web_dir"` //relative to StaticDir
+
+	//TemplateDirs, if given, replaces PagesDir as the list of directories
+	//pages are found in, each with its own SupportDir. They are relative
+	//to the package, but may leave it for one elsewhere in the project,
+	//e.g. "../design/pages". A page in a later directory overrides the
+	//one at the same path in an earlier directory.
+	TemplateDirs []string `json:"template_dirs"`
+}
+
+func defaultLayout() Layout {
+	return Layout{
+		ClientDir:  "client",
+		PagesDir:   "pages",
+		SupportDir: "support",
+		StaticDir:  "static",
+		WebDir:     filepath.Join("en", "web"),
+	}
+}
+
+// Config holds the per-project settings read from seven5.json at the
+// project root. The Layout's fields are set at the top level of the file,
+// beside the rest; any field left out of the file keeps its default.
+type Config struct {
+	Layout
+
+	//JSLayout is "mirror" to place each page's javascript at the same path
+	//under the web directory as its source has under the client package,
+	//or "flat" to put them all in one directory by file name. Either way
+	//they go in JSDir, relative to WebDir ("" for WebDir itself), and end
+	//in JSExtension.
+	JSLayout    string `json:"js_layout"`
+	JSDir       string `json:"js_dir"`
+	JSExtension string `json:"js_extension"`
+
+	//CommonPackage is the import path of a package compiled once, on its
+	//own, to common.js in JSDir, for templates to load before a page's
+	//script. It shares only what it sets up as javascript globals: a page
+	//that imports it still gets its own copy in its script, since
+	//gopherjs can't split a program; see compileCommon
+	CommonPackage string `json:"common_package"`
+
+	//Language picks the locale overlays merged into page data, e.g. with
+	//"fr" product.fr.json is laid over product.json. When WebDir starts
+	//with it, as en/web does, every static/<lang>/web directory is built
+	//too, each with its lang's overlays.
+	Language string `json:"language"`
+
+	//FallbackLanguage is whose overlays a page without one for the
+	//language being built uses instead, e.g. "fr" for a "fr-CA" build;
+	//by default such a page just gets the base data
+	FallbackLanguage string `json:"fallback_language"`
+
+	//LanguageLayout is "dirs" to build each language into its own
+	//static/<lang>/web, or "suffix" to build them all into WebDir with
+	//the language in the file names, e.g. about.fr.html and about.fr.js;
+	//Language's own files keep their plain names. With "suffix" the
+	//languages built are Language and those listed in Languages.
+	LanguageLayout string   `json:"language_layout"`
+	Languages      []string `json:"languages"`
+
+	//SupportAssets are patterns naming files in the support directory
+	//that are served and so copied to the output, e.g. "*.css"
+	SupportAssets []string `json:"support_assets"`
+
+	//Gopherjs and Pagegen are paths to the binaries to run, relative to
+	//the project directory if not absolute; by default both are looked
+	//up on PATH. The GB_SEVEN5_GOPHERJS and GB_SEVEN5_PAGEGEN environment
+	//variables take precedence.
+	Gopherjs string `json:"gopherjs"`
+	Pagegen  string `json:"pagegen"`
+
+	//InheritGopath appends the GOPATH gb seven5 is run with to the
+	//project and its vendor directory in the one gopherjs gets, for
+	//packages installed outside the project
+	InheritGopath bool `json:"inherit_gopath"`
+
+	//PreBuild and PostBuild are shell commands run for each package before
+	//and once it is built, unless --pre-build or --post-build give others
+	PreBuild  string `json:"pre_build"`
+	PostBuild string `json:"post_build"`
+
+	//PagegenArgs are appended, verbatim, to each pagegen command line,
+	//before those of --pagegen-arg
+	PagegenArgs []string `json:"pagegen_args"`
+}
+
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Layout:   defaultLayout(),
+		Language: "en",
+
+		LanguageLayout: "dirs",
+
+		JSLayout:    "mirror",
+		JSExtension: ".js",
+	}
+}
+
+// loadConfig reads the project's config file, if it has one, over the
+// defaults and validates the result.
+func loadConfig(project string) (Config, error) {
+	result := defaultConfig()
+	path := filepath.Join(project, configName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return result, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if err := result.validate(); err != nil {
+		return result, fmt.Errorf("bad configuration in %s: %v", path, err)
+	}
+	for _, binary := range []*string{&result.Gopherjs, &result.Pagegen} {
+		if *binary != "" && !filepath.IsAbs(*binary) {
+			*binary = filepath.Join(project, *binary)
+		}
+	}
+	return result, nil
+}
+
+// toolPath returns the binary to run for name, "gopherjs" or "pagegen":
+// the GB_SEVEN5_<NAME> environment variable if it is set, else the path in
+// the config, else just name so it is found on PATH.
+func toolPath(name string) string {
+	if path := os.Getenv("GB_SEVEN5_" + strings.ToUpper(name)); path != "" {
+		return path
+	}
+	switch name {
+	case "gopherjs":
+		if config.Gopherjs != "" {
+			return config.Gopherjs
+		}
+	case "pagegen":
+		if config.Pagegen != "" {
+			return config.Pagegen
+		}
+	}
+	return name
+}
+
+func (l Layout) validate() error {
+	dirs := []struct{ field, value string }{
+		{"client_dir", l.ClientDir},
+		{"pages_dir", l.PagesDir},
+		{"support_dir", l.SupportDir},
+		{"static_dir", l.StaticDir},
+		{"web_dir", l.WebDir},
+	}
+	for _, dir := range dirs {
+		if err := validateRelativeDir(dir.value); err != nil {
+			return fmt.Errorf("%s: %v", dir.field, err)
+		}
+	}
+	for _, dir := range l.TemplateDirs {
+		if dir == "" || filepath.IsAbs(dir) {
+			return fmt.Errorf("template_dirs: %q must be relative to the package directory", dir)
+		}
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	if err := c.Layout.validate(); err != nil {
+		return err
+	}
+	if c.JSLayout != "mirror" && c.JSLayout != "flat" {
+		return fmt.Errorf("js_layout: must be mirror or flat, got %q", c.JSLayout)
+	}
+	if c.JSDir != "" {
+		if err := validateRelativeDir(c.JSDir); err != nil {
+			return fmt.Errorf("js_dir: %v", err)
+		}
+	}
+	if !strings.HasPrefix(c.JSExtension, ".") || len(c.JSExtension) < 2 || strings.ContainsAny(c.JSExtension, "/\\") {
+		return fmt.Errorf("js_extension: must be like .js, got %q", c.JSExtension)
+	}
+	if err := validateCommonPackage(c.CommonPackage); err != nil {
+		return err
+	}
+	if c.Language == "" || strings.ContainsAny(c.Language, "./\\") {
+		return fmt.Errorf("language: bad language %q", c.Language)
+	}
+	if strings.ContainsAny(c.FallbackLanguage, "./\\") {
+		return fmt.Errorf("fallback_language: bad language %q", c.FallbackLanguage)
+	}
+	if c.LanguageLayout != "dirs" && c.LanguageLayout != "suffix" {
+		return fmt.Errorf("language_layout: must be dirs or suffix, got %q", c.LanguageLayout)
+	}
+	for _, lang := range c.Languages {
+		if lang == "" || strings.ContainsAny(lang, "./\\") {
+			return fmt.Errorf("languages: bad language %q", lang)
+		}
+	}
+	if len(c.Languages) > 0 && c.LanguageLayout != "suffix" {
+		return fmt.Errorf("languages: only used with the suffix language_layout; dirs finds them under static_dir")
+	}
+	for _, pattern := range c.SupportAssets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("support_assets: bad pattern %q", pattern)
+		}
+	}
+	if err := validatePagegenArgs(c.PagegenArgs); err != nil {
+		return fmt.Errorf("pagegen_args: %v", err)
+	}
+	return nil
+}
+
+func validateRelativeDir(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("directory name must not be empty")
+	}
+	if filepath.IsAbs(dir) {
+		return fmt.Errorf("%s must be relative to the package directory", dir)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if part == ".." {
+			return fmt.Errorf("%s must not leave the package directory", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isDataFile reports whether name holds page data: json, which pagegen
+// reads directly, or yaml, which is converted to json for it.
+func isDataFile(name string) bool {
+	return strings.HasSuffix(name, ".json") || isYAMLFile(name)
+}
+
+func isYAMLFile(name string) bool {
+	return strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml")
+}
+
+var dataExtensions = []string{".json", ".yaml", ".yml"}
+
+// isOverlay reports whether path is a locale overlay, like product.fr.json
+// beside a product.json (or .yaml, or a product.html with front matter),
+// rather than page data of its own.
+func isOverlay(path string) bool {
+	root := strings.TrimSuffix(path, filepath.Ext(path))
+	lang := filepath.Ext(root)
+	if lang == "" {
+		return false
+	}
+	base := strings.TrimSuffix(root, lang)
+	for _, ext := range dataExtensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			return true
+		}
+	}
+	return hasFrontMatter(base + ".html")
+}
+
+// overlayFor returns the overlay for lang of the data file at path, or ""
+// if there is none and the base data is used as is.
+func overlayFor(path string, lang string) string {
+	root := strings.TrimSuffix(path, filepath.Ext(path)) + "." + lang
+	for _, ext := range dataExtensions {
+		if _, err := os.Stat(root + ext); err == nil {
+			return root + ext
+		}
+	}
+	return ""
+}
+
+// mergeData returns base with overlay laid over it: objects are merged key
+// by key, recursively, and any other overlay value replaces the base one.
+func mergeData(base interface{}, overlay interface{}) interface{} {
+	baseFields, ok := base.(map[string]interface{})
+	if !ok {
+		return overlay
+	}
+	overlayFields, ok := overlay.(map[string]interface{})
+	if !ok {
+		return overlay
+	}
+	merged := make(map[string]interface{}, len(baseFields))
+	for key, value := range baseFields {
+		merged[key] = value
+	}
+	for key, value := range overlayFields {
+		if old, ok := merged[key]; ok {
+			value = mergeData(old, value)
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// checkSingleDataFile fails if another data file with the same name but a
+// different extension sits beside path, since both would produce the same
+// page and picking one silently would hide the other.
+func checkSingleDataFile(path string) error {
+	root := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range dataExtensions {
+		other := root + ext
+		if other == path {
+			continue
+		}
+		if _, err := os.Stat(other); err == nil {
+			return fmt.Errorf("%s and %s both provide data for the same page, remove one", path, other)
+		}
+	}
+	return nil
+}
+
+// readDataFile parses the json or yaml file at path, or the front matter
+// of an html template, and expands the environment variables its strings
+// refer to. Syntax errors are reported with the line (and for json the
+// column) where they occur.
+func readDataFile(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if filepath.Ext(path) == ".html" {
+		front, _, ok := splitFrontMatter(data)
+		if !ok {
+			return nil, nil
+		}
+		//the opening --- is line 1
+		v, err = parseData(path, front, !bytes.HasPrefix(bytes.TrimSpace(front), []byte("{")), 1)
+	} else {
+		v, err = parseData(path, data, isYAMLFile(path), 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expandEnv(path, v)
+}
+
+// parseData parses data, read from path starting after its first skip
+// lines, as yaml or json.
+func parseData(path string, data []byte, yaml bool, skip int) (interface{}, error) {
+	if yaml {
+		v, err := parseYAML(data)
+		if yamlErr, ok := err.(*yamlError); ok {
+			return nil, fmt.Errorf("%s:%d: %s", path, yamlErr.line+skip, yamlErr.msg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return v, nil
+	}
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if syntaxError, ok := err.(*json.SyntaxError); ok {
+		line, col := lineAndColumn(data, syntaxError.Offset)
+		return nil, fmt.Errorf("%s:%d:%d: %v", path, line+skip, col, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return v, nil
+}
+
+// lineAndColumn converts the offset of a json.SyntaxError, which counts the
+// offending byte, to the 1-based line and column of that byte.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset--
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// writeDataJSON writes data as json to path, for pagegen.
+func writeDataJSON(path string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0644)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDataFileSyntaxError(t *testing.T) {
+	resetOptions(t)
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"comma.json", "{\n  \"Title\": \"home\",\n}\n", "comma.json:3:1: "},
+		{"quote.json", "{\"Title\": \"home}\n", "quote.json:1:17: "},
+		{"value.json", "{\n\n  \"Title\": home\n}\n", "value.json:3:12: "},
+		{"front.html", "---\n{\"Title\" \"home\"}\n---\n<p>{{.Title}}</p>\n", "front.html:2:10: "},
+	}
+	for _, test := range tests {
+		writeFiles(t, dir, map[string]string{test.name: test.source})
+		_, err := readDataFile(filepath.Join(dir, test.name))
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q, want it to name %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// envReference matches ${NAME} and ${NAME:-default} in data strings, and
+// $${ which escapes a literal ${. Any other $ is left as it is, so prices
+// and the like need no escaping.
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces the environment variable references in the strings
+// of v, data read from path, with their values. A variable that is unset,
+// or empty, takes its default; with no default that is an error.
+func expandEnv(path string, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		var failed error
+		expanded := envReference.ReplaceAllStringFunc(v, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			parts := envReference.FindStringSubmatch(match)
+			if value := os.Getenv(parts[1]); value != "" {
+				return value
+			}
+			if len(match) > len(parts[1])+3 {
+				return parts[2] //has a default, maybe an empty one
+			}
+			if failed == nil {
+				failed = fmt.Errorf("%s: environment variable %s is not set (use ${%s:-default} to give a default)",
+					path, parts[1], parts[1])
+			}
+			return match
+		})
+		return expanded, failed
+	case map[string]interface{}:
+		for key, value := range v {
+			expanded, err := expandEnv(path, value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, value := range v {
+			expanded, err := expandEnv(path, value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return v, nil
+}
+
+// usesEnv reports whether any of files refers to an environment variable
+// or escapes a ${, in which case pagegen has to be given the expanded
+// data.
+func usesEnv(files ...string) bool {
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err == nil && envReference.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// envInputs returns NAME=value for each environment variable that files
+// refer to, sorted, so that a page is regenerated when one changes.
+func envInputs(files []string) []string {
+	seen := map[string]bool{}
+	inputs := []string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue //reported when the file is read for the page
+		}
+		for _, parts := range envReference.FindAllStringSubmatch(string(data), -1) {
+			if parts[1] == "" || seen[parts[1]] {
+				continue
+			}
+			seen[parts[1]] = true
+			inputs = append(inputs, parts[1]+"="+os.Getenv(parts[1]))
+		}
+	}
+	sort.Strings(inputs)
+	return inputs
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvReferences(t *testing.T) {
+	t.Setenv("SEVEN5_TEST_HOST", "example.com")
+	t.Setenv("SEVEN5_TEST_EMPTY", "")
+	tests := []struct {
+		name   string
+		data   string
+		uses   bool
+		inputs []string
+		want   string
+	}{
+		{"plain", `{"a": "costs $5"}`, false, []string{}, "costs $5"},
+		{"reference", `{"a": "https://${SEVEN5_TEST_HOST}/"}`, true,
+			[]string{"SEVEN5_TEST_HOST=example.com"}, "https://example.com/"},
+		{"default", `{"a": "${SEVEN5_TEST_EMPTY:-none}"}`, true, []string{"SEVEN5_TEST_EMPTY="}, "none"},
+		{"escape only", `{"a": "$${SEVEN5_TEST_HOST}"}`, true, []string{}, "${SEVEN5_TEST_HOST}"},
+		{"escape and reference", `{"a": "$${x} ${SEVEN5_TEST_HOST}"}`, true,
+			[]string{"SEVEN5_TEST_HOST=example.com"}, "${x} example.com"},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		path := filepath.Join(dir, strings.Replace(test.name, " ", "-", -1)+".json")
+		writeFiles(t, dir, map[string]string{filepath.Base(path): test.data})
+		if got := usesEnv(path); got != test.uses {
+			t.Errorf("%s: usesEnv = %v, want %v", test.name, got, test.uses)
+		}
+		if got := envInputs([]string{path}); !reflect.DeepEqual(got, test.inputs) {
+			t.Errorf("%s: envInputs = %q, want %q", test.name, got, test.inputs)
+		}
+		data, err := readDataFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := data.(map[string]interface{})["a"]; got != test.want {
+			t.Errorf("%s: expanded to %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRunEscapeOnlyData(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	writeFiles(t, project, map[string]string{
+		"src/site/pages/index.json": `{"Title": "$${not a variable}"}`,
+	})
+	if err := run(project, []string{"site"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range fake.commands("pagegen") {
+		if len(call.args) > 7 && call.args[0] == "--support" && call.args[7] == "/index.json" {
+			t.Errorf("pagegen was given the unexpanded data: %v", call.args)
+		}
+	}
+}
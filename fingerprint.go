@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const revManifestName = "rev-manifest.json"
+
+func constructRevManifestPath(project string, arg string, lang string) string {
+	return filepath.Join(constructWebPath(project, arg, lang), languageSuffix(revManifestName, lang))
+}
+
+// fingerprintScripts gives each compiled page a copy named after a hash of
+// its contents, e.g. about.3f9a2c1b.js beside about.js, and writes the
+// mapping from one name to the other, relative to the web directory, to
+// the rev-manifest there. The unhashed file is kept since it is what the
+// up to date checks look at.
+func fingerprintScripts(project string, arg string, lang string) error {
+	web := constructWebPath(project, arg, lang)
+	manifest := manifestFor(project, arg)
+	revs := map[string]string{}
+	for _, entry := range manifest.sortedUnder(web) {
+		if entry.Step != "gopherjs" || (suffixLayout() && outputLanguage(entry.Output) != lang) {
+			continue
+		}
+		target := filepath.Join(project, filepath.FromSlash(entry.Output))
+		data, err := ioutil.ReadFile(target)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		ext := filepath.Ext(target)
+		hashed := strings.TrimSuffix(target, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+		if _, err := os.Stat(hashed); err != nil {
+			if err := writeFileAtomic(hashed, data); err != nil {
+				return err
+			}
+			logAt(os.Stdout, severityDone, "gb seven5: fingerprinted %s\n", hashed)
+		}
+		manifest.record("fingerprint", target, hashed)
+		revs[webRelative(web, target)] = webRelative(web, hashed)
+	}
+	data, err := json.MarshalIndent(revs, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	revPath := constructRevManifestPath(project, arg, lang)
+	manifest.record("fingerprint", web, revPath)
+	//rewriting an unchanged rev-manifest would make every page out of date
+	if old, err := ioutil.ReadFile(revPath); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	return writeFileAtomic(revPath, data)
+}
+
+func readRevManifest(project string, arg string, lang string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(constructRevManifestPath(project, arg, lang))
+	if err != nil {
+		return nil, err
+	}
+	revs := map[string]string{}
+	if err := json.Unmarshal(data, &revs); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+var scriptSrc = regexp.MustCompile(`(?i)(<script\b[^>]*?\bsrc\s*=\s*)("[^"]*"|'[^']*')`)
+
+// rewriteScriptRefs points the script elements of the generated page at
+// out, in lang's web directory, to the fingerprinted names listed in revs.
+func rewriteScriptRefs(project string, arg string, lang string, out string, revs map[string]string) error {
+	page, err := ioutil.ReadFile(out)
+	if err != nil {
+		return err
+	}
+	dir := path.Dir(webRelative(constructWebPath(project, arg, lang), out))
+	rewritten := scriptSrc.ReplaceAllFunc(page, func(match []byte) []byte {
+		parts := scriptSrc.FindSubmatch(match)
+		quoted := string(parts[2])
+		src := quoted[1 : len(quoted)-1]
+		hashed, ok := revs[resolveScriptSrc(dir, src)]
+		if !ok {
+			return match
+		}
+		src = strings.TrimSuffix(src, path.Base(src)) + path.Base(hashed)
+		return []byte(string(parts[1]) + quoted[:1] + src + quoted[:1])
+	})
+	if bytes.Equal(page, rewritten) {
+		return nil
+	}
+	return writeFileAtomic(out, rewritten)
+}
+
+// resolveScriptSrc returns the web directory relative path that src, a
+// script reference in a page in dir, names; references to other hosts or
+// with a query come back as "" and are left alone.
+func resolveScriptSrc(dir string, src string) string {
+	if strings.Contains(src, "://") || strings.HasPrefix(src, "//") || strings.ContainsAny(src, "?#") {
+		return ""
+	}
+	if strings.HasPrefix(src, "/") {
+		return strings.TrimPrefix(path.Clean(src), "/")
+	}
+	return path.Join(dir, src)
+}
+
+func webRelative(web string, p string) string {
+	rel, err := filepath.Rel(web, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitFrontMatter separates the front matter of an html template, the
+// lines between a first line of --- and the next line of ---, from the
+// html after it. ok is false if the template has no front matter.
+func splitFrontMatter(data []byte) (front []byte, body []byte, ok bool) {
+	first := bytes.IndexByte(data, '\n')
+	if first < 0 || string(bytes.TrimRight(data[:first], "\r")) != "---" {
+		return nil, data, false
+	}
+	start := first + 1
+	for i := start; i < len(data); {
+		end := bytes.IndexByte(data[i:], '\n')
+		line := data[i:]
+		next := len(data)
+		if end >= 0 {
+			line = data[i : i+end]
+			next = i + end + 1
+		}
+		if string(bytes.TrimRight(line, "\r")) == "---" {
+			return data[start:i], data[next:], true
+		}
+		i = next
+	}
+	return nil, data, false
+}
+
+// hasFrontMatter reports whether the html template at path starts with
+// front matter. Only the first line is read for a template without.
+func hasFrontMatter(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || strings.TrimRight(line, "\r\n") != "---" {
+		return false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	_, _, ok := splitFrontMatter(data)
+	return ok
+}
+
+// dataFileFor returns the json or yaml data file beside the html template,
+// or "" if there is none.
+func dataFileFor(html string) string {
+	root := strings.TrimSuffix(html, filepath.Ext(html))
+	for _, ext := range dataExtensions {
+		if _, err := os.Stat(root + ext); err == nil {
+			return root + ext
+		}
+	}
+	return ""
+}
+
+// writeTemplateBody writes the html template at path, less its front matter,
+// to target for pagegen.
+func writeTemplateBody(path string, target string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, body, _ := splitFrontMatter(data)
+	return ioutil.WriteFile(target, body, 0644)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// gopherjsCache is the directory every gopherjs compile shares its compiled
+// packages through; "" for pkg/gopherjs-cache in the project, beside gb's
+// own build output.
+var gopherjsCache = ""
+
+var (
+	cacheLock    sync.Mutex
+	cacheChecked bool
+	cacheWarm    bool
+)
+
+func constructGopherjsCachePath(project string) string {
+	if gopherjsCache != "" {
+		return gopherjsCache
+	}
+	return filepath.Join(project, "pkg", "gopherjs-cache")
+}
+
+// gopherjsEnv returns the environment gopherjs runs in: the project's
+// GOPATH, and the shared cache. Projects are laid out for GOPATH, so
+// modules are off unless GO111MODULE asks for them. gopherjs keeps its
+// cache in the user cache directory, which XDG_CACHE_HOME moves on Linux
+// and the BSDs; the go command's cache is found there too unless GOCACHE
+// says otherwise, so it is pinned where it was to stay warm.
+func gopherjsEnv(project string) []string {
+	env := append(os.Environ(), "GOPATH="+gopherjsPath(project))
+	if os.Getenv("GO111MODULE") == "" {
+		env = append(env, "GO111MODULE=off")
+	}
+	if os.Getenv("GOCACHE") == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			env = append(env, "GOCACHE="+filepath.Join(dir, "go-build"))
+		}
+	}
+	return append(env, "XDG_CACHE_HOME="+constructGopherjsCachePath(project))
+}
+
+// awaitWarmCache makes the first compile into a cold cache run alone, so
+// the packages the pages share are compiled into it once rather than by
+// every compile at the same time, each overwriting the others. It reports
+// whether the cache was warm, and returns the func to call once the
+// compile is done.
+func awaitWarmCache(project string) (bool, func()) {
+	cacheLock.Lock()
+	if !cacheChecked {
+		cacheChecked = true
+		dir := constructGopherjsCachePath(project)
+		entries, _ := ioutil.ReadDir(dir)
+		cacheWarm = len(entries) > 0
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logAt(os.Stderr, severityWarning, "gb seven5: warning: unable to create gopherjs cache %s: %v\n", dir, err)
+		}
+	}
+	if cacheWarm {
+		cacheLock.Unlock()
+		return true, func() {}
+	}
+	return false, func() {
+		cacheWarm = true
+		cacheLock.Unlock()
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// runHook runs command, the user's hook named hook (e.g. "post-build"), for
+// package arg through the shell. The project directory, package and web
+// output directory of lang are in its environment as GB_PROJECT_DIR,
+// GB_SEVEN5_PACKAGE and GB_SEVEN5_OUTPUT_DIR, and its output is logged
+// like that of gopherjs and pagegen.
+func runHook(project string, arg string, lang string, hook string, command string) error {
+	shell, flag := shellCommand()
+	if dryRun {
+		logAt(os.Stdout, severityCommand, "gb seven5: would run %s hook for %s: %s\n", hook, arg, command)
+		return nil
+	}
+	env := append(os.Environ(),
+		"GB_PROJECT_DIR="+project,
+		"GB_SEVEN5_PACKAGE="+arg,
+		"GB_SEVEN5_OUTPUT_DIR="+constructWebPath(project, arg, lang))
+	stdout := newLineWriter(os.Stdout, arg+" "+hook)
+	stderr := newLineWriter(os.Stderr, arg+" "+hook)
+	err := runWithTimeout(buildContext, shell, []string{flag, command}, env, nil, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil && buildContext.Err() == nil {
+		logf(os.Stderr, "%s hook failed for %s: %v\n", hook, arg, err)
+	}
+	return err
+}
+
+// dataFilter is the --data-filter command, if any.
+var dataFilter = ""
+
+// filterData runs the --data-filter command on data, that of the page of
+// lang built from the data file source, and returns the data it writes
+// back.
+// The command reads the page's json on stdin and writes the json to pass
+// to pagegen on stdout; the data file is in its environment as
+// GB_SEVEN5_DATA_FILE, alongside the variables hooks get. Its stderr is
+// logged, and a failure or output that isn't json fails the page.
+func filterData(project string, arg string, lang string, source string, data interface{}) (interface{}, error) {
+	input, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	shell, flag := shellCommand()
+	env := append(os.Environ(),
+		"GB_PROJECT_DIR="+project,
+		"GB_SEVEN5_PACKAGE="+arg,
+		"GB_SEVEN5_OUTPUT_DIR="+constructWebPath(project, arg, lang),
+		"GB_SEVEN5_DATA_FILE="+source)
+	var out bytes.Buffer
+	stderr := newLineWriter(os.Stderr, arg+" data-filter")
+	err = runWithTimeout(buildContext, shell, []string{flag, dataFilter}, env, bytes.NewReader(input), &out, stderr)
+	stderr.Flush()
+	if err != nil {
+		if buildContext.Err() == nil {
+			logf(os.Stderr, "data filter failed for %s: %v\n", source, err)
+		}
+		return nil, err
+	}
+	var filtered interface{}
+	if err := json.Unmarshal(out.Bytes(), &filtered); err != nil {
+		err = fmt.Errorf("data filter output for %s is not json: %v", source, err)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	return filtered, nil
+}
+
+// shellCommand returns the shell that hooks and filters run in, and the
+// flag that gives it a command.
+func shellCommand() (string, string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", "/C"
+	}
+	return "sh", "-c"
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile lists, gitignore style, the files at the package root that gb
+// seven5 should act as if weren't there.
+const ignoreFile = ".seven5ignore"
+
+// ignoreRule is one line of an ignore file. A pattern with a slash before its
+// end is relative to the package root; one without matches a name at any
+// depth. A trailing slash matches only directories, ** matches any number of
+// directories and a leading ! re-includes what an earlier line ignored.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreRules are the rules of a package's ignore file, nil when it has
+// none.
+//
+// As with git, the last line that matches a path decides, so "!keep.json"
+// after "*.json" keeps keep.json. The exception is a path inside an ignored
+// directory: the directory isn't walked at all, so nothing in it can be
+// re-included; ignore "scratch/*" rather than "scratch/" to allow that.
+type ignoreRules struct {
+	root  string
+	rules []ignoreRule
+}
+
+func constructIgnorePath(project string, arg string) string {
+	return filepath.Join(constructPackagePath(project, arg), ignoreFile)
+}
+
+// readIgnoreRules reads arg's ignore file, which needn't exist.
+func readIgnoreRules(project string, arg string) (*ignoreRules, error) {
+	name := constructIgnorePath(project, arg)
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	result := &ignoreRules{root: filepath.Dir(name)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		rule, ok, err := parseIgnoreRule(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if ok {
+			result.rules = append(result.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ignoresFor returns arg's ignore rules; an unreadable ignore file was
+// already reported by validateProjectStructure, and ignores nothing.
+func ignoresFor(project string, arg string) *ignoreRules {
+	rules, err := readIgnoreRules(project, arg)
+	if err != nil {
+		return nil
+	}
+	return rules
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool, error) {
+	rule := ignoreRule{}
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] //for a name starting with # or !
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	//without a slash, a pattern can match at any depth
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false, nil
+	}
+	rule.segments = strings.Split(line, "/")
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return rule, false, fmt.Errorf("bad pattern %q: %v", line, err)
+		}
+	}
+	return rule, true, nil
+}
+
+// ignored reports whether path, which is a directory if isDir, is to be
+// skipped. A path outside the package root is never ignored.
+func (r *ignoreRules) ignored(path string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	rel, err := filepath.Rel(r.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	names := strings.Split(filepath.ToSlash(rel), "/")
+	result := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(rule.segments, names) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// skip is a walk func's answer for an ignored path: skip the whole of a
+// directory, or just the file. info is nil when the walk couldn't read
+// path, which is left to the walk func to report.
+func (r *ignoreRules) skip(path string, info os.FileInfo) (bool, error) {
+	if info == nil || !r.ignored(path, info.IsDir()) {
+		return false, nil
+	}
+	if info.IsDir() {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
+
+func matchSegments(pattern []string, names []string) bool {
+	if len(pattern) == 0 {
+		return len(names) == 0
+	}
+	if pattern[0] == "**" {
+		//try each number of directories the ** could stand for
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(pattern[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], names[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], names[1:])
+}
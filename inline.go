@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	inlineJS    = false
+	inlineLimit = 16 * 1024
+)
+
+var scriptElement = regexp.MustCompile(`(?is)<script\b([^>]*?)\s+src\s*=\s*("[^"]*"|'[^']*')([^>]*)>\s*</script\s*>`)
+
+var sourceMappingURL = regexp.MustCompile(`(?m)^//# sourceMappingURL=(\S+)\s*$`)
+
+// compiledScripts returns the compiled javascript of this build by its web
+// directory relative path; it must be called after gopherjsCompilation.
+func compiledScripts(project string, arg string, lang string) map[string]string {
+	web := constructWebPath(project, arg, lang)
+	scripts := map[string]string{}
+	for _, entry := range manifestFor(project, arg).sortedUnder(web) {
+		if entry.Step != "gopherjs" {
+			continue
+		}
+		target := filepath.Join(project, filepath.FromSlash(entry.Output))
+		scripts[webRelative(web, target)] = target
+	}
+	return scripts
+}
+
+// inlineScripts replaces each script element of the generated page at out,
+// in lang's web directory, whose src is one of the compiled scripts with an
+// element holding that javascript, unless it is bigger than
+// --inline-js-limit.
+func inlineScripts(project string, arg string, lang string, out string, scripts map[string]string) error {
+	page, err := ioutil.ReadFile(out)
+	if err != nil {
+		return err
+	}
+	dir := path.Dir(webRelative(constructWebPath(project, arg, lang), out))
+	var failed error
+	inlined := scriptElement.ReplaceAllFunc(page, func(match []byte) []byte {
+		parts := scriptElement.FindSubmatch(match)
+		quoted := string(parts[2])
+		src := resolveScriptSrc(dir, quoted[1:len(quoted)-1])
+		target, ok := scripts[src]
+		if !ok || failed != nil {
+			return match
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			failed = err
+			return match
+		}
+		if info.Size() > int64(inlineLimit) {
+			if verbose {
+				logf(os.Stdout, "gb seven5: not inlining %s in %s, %d bytes is over the limit\n", target, out, info.Size())
+			}
+			return match
+		}
+		js, err := ioutil.ReadFile(target)
+		if err != nil {
+			failed = err
+			return match
+		}
+		js = relocateSourceMap(js, path.Dir(src), dir)
+		//the page would otherwise end the element early
+		js = bytes.Replace(js, []byte("</script"), []byte(`<\/script`), -1)
+		var element bytes.Buffer
+		element.WriteString("<script")
+		element.Write(parts[1])
+		element.Write(parts[3])
+		element.WriteString(">")
+		element.Write(js)
+		element.WriteString("</script>")
+		return element.Bytes()
+	})
+	if failed != nil {
+		logf(os.Stderr, "unable to inline javascript in %s: %v\n", out, failed)
+		return failed
+	}
+	if bytes.Equal(page, inlined) {
+		return nil
+	}
+	return writeFileAtomic(out, inlined)
+}
+
+// relocateSourceMap rewrites a relative source map reference in js, which
+// was compiled into jsDir, so it still resolves from a page in pageDir.
+func relocateSourceMap(js []byte, jsDir string, pageDir string) []byte {
+	return sourceMappingURL.ReplaceAllFunc(js, func(match []byte) []byte {
+		ref := string(sourceMappingURL.FindSubmatch(match)[1])
+		if strings.Contains(ref, ":") || strings.HasPrefix(ref, "/") {
+			return match
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(pageDir), filepath.FromSlash(path.Join(jsDir, ref)))
+		if err != nil {
+			return match
+		}
+		return []byte("//# sourceMappingURL=" + filepath.ToSlash(rel))
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// languages holds the --lang names; when there are any only those of a
+// package's languages are built.
+var languages stringList
+
+// webDirFor returns the web directory of lang relative to the static
+// directory. When the first element of WebDir is the configured language,
+// as in the default en/web, that element names the language and is
+// replaced; otherwise every language shares WebDir.
+func webDirFor(lang string) string {
+	if suffixLayout() {
+		return config.Layout.WebDir
+	}
+	parts := strings.SplitN(filepath.ToSlash(config.Layout.WebDir), "/", 2)
+	if parts[0] != config.Language {
+		return config.Layout.WebDir
+	}
+	parts[0] = lang
+	return filepath.FromSlash(strings.Join(parts, "/"))
+}
+
+// discoverLanguages returns the languages arg has a web directory for,
+// e.g. en, fr and de for static/en/web, static/fr/web and static/de/web,
+// in name order. If WebDir doesn't name a language, or there are none,
+// that is just the configured language.
+func discoverLanguages(project string, arg string) ([]string, error) {
+	if suffixLayout() {
+		langs := []string{config.Language}
+		for _, lang := range config.Languages {
+			if !containsString(langs, lang) {
+				langs = append(langs, lang)
+			}
+		}
+		return langs, nil
+	}
+	if webDirFor("") == config.Layout.WebDir {
+		return []string{config.Language}, nil
+	}
+	static := filepath.Join(constructPackagePath(project, arg), config.Layout.StaticDir)
+	infos, err := ioutil.ReadDir(static)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	found := []string{}
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() || strings.HasPrefix(name, ".") || strings.Contains(name, ".") {
+			continue
+		}
+		//other directories under static aren't languages
+		if web, err := os.Stat(filepath.Join(static, webDirFor(name))); err != nil || !web.IsDir() {
+			continue
+		}
+		found = append(found, name)
+	}
+	if len(found) == 0 {
+		return []string{config.Language}, nil
+	}
+	return found, nil
+}
+
+// languagesFor returns the languages of arg to build: those discovered,
+// or the ones given with --lang. A --lang that arg has no web directory
+// for fails, unless the output goes elsewhere with --out.
+func languagesFor(project string, arg string) ([]string, error) {
+	found, err := discoverLanguages(project, arg)
+	if err != nil {
+		logf(os.Stderr, "unable to find the languages of %s: %v\n", arg, err)
+		return nil, err
+	}
+	if len(languages) == 0 {
+		return found, nil
+	}
+	for _, lang := range languages {
+		if !containsString(found, lang) && suffixLayout() {
+			err := fmt.Errorf("language %q is not one of the languages in %s", lang, configName)
+			logf(os.Stderr, "%v\n", err)
+			return nil, err
+		}
+		if !containsString(found, lang) && outDir == "" {
+			err := fmt.Errorf("no %s directory for language %q in %s",
+				filepath.Join(config.Layout.StaticDir, webDirFor(lang)), lang, arg)
+			logf(os.Stderr, "%v\n", err)
+			return nil, err
+		}
+	}
+	return languages, nil
+}
+
+// forEachLanguage calls fn with each of langs in turn, stopping at the
+// first error.
+func forEachLanguage(langs []string, fn func(lang string) error) error {
+	for _, lang := range langs {
+		if err := fn(lang); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepOtherLanguages carries the previous manifest's entries for the
+// languages that --lang left out into this build's, so their output isn't
+// treated as orphaned.
+func keepOtherLanguages(project string, arg string, langs []string) error {
+	previous, err := readManifest(project, arg)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	built := []string{}
+	for _, lang := range langs {
+		web := filepath.Join(constructStaticPath(project, arg), webDirFor(lang))
+		built = append(built, projectRelative(project, web)+"/")
+	}
+	current := manifestFor(project, arg)
+	for _, entry := range previous {
+		other := true
+		for _, prefix := range built {
+			if strings.HasPrefix(entry.Output, prefix) {
+				other = false
+				break
+			}
+		}
+		//the languages share one directory, the names tell them apart
+		if suffixLayout() {
+			other = !containsString(langs, outputLanguage(entry.Output))
+		}
+		if other && !current.has(entry.Output) {
+			current.add(entry)
+		}
+	}
+	return nil
+}
+
+// suffixLayout reports whether every language is built into the one web
+// directory, with the language in the file names (language_layout).
+func suffixLayout() bool {
+	return config.LanguageLayout == "suffix"
+}
+
+// languageSuffix returns name as it is written for lang: under the suffix
+// layout, about.html becomes about.fr.html for fr. The configured
+// language's files, and every file in the dirs layout, keep their name.
+func languageSuffix(name string, lang string) string {
+	if !suffixLayout() || lang == config.Language {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + lang + ext
+}
+
+// outputLanguage returns the language an output in the shared web
+// directory of the suffix layout was written for, found among the dot
+// separated parts of its name, e.g. fr for about.fr.3f9a2c1b.js. A name
+// without one is the configured language's.
+func outputLanguage(output string) string {
+	parts := strings.Split(path.Base(filepath.ToSlash(output)), ".")
+	for _, part := range parts[1:] {
+		if part != config.Language && containsString(config.Languages, part) {
+			return part
+		}
+	}
+	return config.Language
+}
+
+// languageScriptRefs maps each script a page of lang may refer to by its
+// plain name, relative to the web directory, to the one compiled for lang,
+// as rewriteScriptRefs takes. It is empty unless the suffix layout gives
+// the language its own names.
+func languageScriptRefs(project string, arg string, lang string) map[string]string {
+	refs := map[string]string{}
+	if languageSuffix("", lang) == "" {
+		return refs
+	}
+	web := constructWebPath(project, arg, lang)
+	for _, entry := range manifestFor(project, arg).sortedUnder(web) {
+		if entry.Step != "gopherjs" || outputLanguage(entry.Output) != lang {
+			continue
+		}
+		rel := webRelative(web, filepath.Join(project, filepath.FromSlash(entry.Output)))
+		plain := strings.TrimSuffix(rel, "."+lang+config.JSExtension) + config.JSExtension
+		refs[plain] = rel
+	}
+	return refs
+}
+
+// translationFor returns the overlay to use for the data file at path when
+// building lang. If lang has none, that of the fallback language is used,
+// if any, and the page is logged as untranslated so translators can see
+// what is outstanding. It is "" when the base data is to be used as is.
+func translationFor(path string, lang string) string {
+	overlay := overlayFor(path, lang)
+	if overlay != "" || lang == config.Language {
+		return overlay
+	}
+	fallback := config.Language
+	if config.FallbackLanguage != "" && config.FallbackLanguage != config.Language {
+		fallback = config.FallbackLanguage
+		overlay = overlayFor(path, fallback)
+		if overlay == "" {
+			fallback = config.Language
+		}
+	}
+	logAt(os.Stderr, severityWarning, "gb seven5: warning: %s has no %s translation, using %s\n", path, lang, fallback)
+	return overlay
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// checkLinks makes the build look for local href and src references in the
+// generated pages that name no file in the output.
+var checkLinks = false
+
+var linkAttribute = regexp.MustCompile(`(?i)<[a-z][^>]*?\s(?:href|src)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+
+var htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// linkScheme matches a reference with a scheme, e.g. https: or mailto:,
+// which is never a file of the site.
+var linkScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// checkPageLinks reports each local reference in the pages generated for
+// arg's lang that resolves to nothing in its web directory: a warning, or
+// under --strict an error. External URLs and links within a page are left
+// alone; a reference to a directory needs its index.html.
+func checkPageLinks(project string, arg string, lang string) error {
+	web := constructWebPath(project, arg, lang)
+	broken := 0
+	for _, entry := range manifestFor(project, arg).sortedUnder(web) {
+		if entry.Step != "pagegen" || (suffixLayout() && outputLanguage(entry.Output) != lang) {
+			continue
+		}
+		page := filepath.Join(project, filepath.FromSlash(entry.Output))
+		links, err := brokenLinks(web, page)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if strict {
+				logf(os.Stderr, "gb seven5: %s: broken link %s\n", projectRelative(project, page), link)
+			} else {
+				logAt(os.Stderr, severityWarning, "gb seven5: warning: %s: broken link %s\n", projectRelative(project, page), link)
+			}
+		}
+		broken += len(links)
+	}
+	if broken > 0 && strict {
+		return fmt.Errorf("%d broken link(s) (--strict)", broken)
+	}
+	return nil
+}
+
+// brokenLinks returns the references in page that name no file under web,
+// each once, in the order they first appear.
+func brokenLinks(web string, page string) ([]string, error) {
+	data, err := ioutil.ReadFile(page)
+	if err != nil {
+		return nil, err
+	}
+	html := htmlComment.ReplaceAllString(string(data), "")
+	dir := path.Dir(webRelative(web, page))
+	result := []string{}
+	seen := map[string]bool{}
+	for _, match := range linkAttribute.FindAllStringSubmatch(html, -1) {
+		link := strings.Trim(match[1], `"'`)
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		if target, ok := linkTarget(dir, link); ok && !siteFileExists(web, target) {
+			result = append(result, link)
+		}
+	}
+	return result, nil
+}
+
+// linkTarget resolves link, found in a page in dir, to a path relative to
+// the web directory; it is false for a link that isn't to a file of the
+// site.
+func linkTarget(dir string, link string) (string, bool) {
+	link = strings.TrimSpace(link)
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		link = link[:i]
+	}
+	if link == "" || strings.HasPrefix(link, "//") || linkScheme.MatchString(link) {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(link); err == nil {
+		link = unescaped
+	}
+	directory := strings.HasSuffix(link, "/")
+	if strings.HasPrefix(link, "/") {
+		link = path.Clean(link)
+	} else {
+		link = path.Join("/", dir, link)
+	}
+	if directory {
+		link = path.Join(link, "index.html")
+	}
+	return strings.TrimPrefix(link, "/"), true
+}
+
+func siteFileExists(web string, target string) bool {
+	info, err := os.Stat(filepath.Join(web, filepath.FromSlash(target)))
+	if err == nil && info.IsDir() {
+		_, err = os.Stat(filepath.Join(web, filepath.FromSlash(target), "index.html"))
+	}
+	return err == nil
+}
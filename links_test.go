@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPageLinksSeverity(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		want    string
+		wantErr bool
+	}{
+		{"warning", nil, "gb seven5: warning: src/site/static/en/web/index.html: broken link missing.html\n", false},
+		{"json warning", []string{"--log-format", "json"},
+			`"event":"warning","message":"src/site/static/en/web/index.html: broken link missing.html"`, false},
+		{"strict", []string{"--strict"}, "gb seven5: src/site/static/en/web/index.html: broken link missing.html\n", true},
+		{"json strict", []string{"--strict", "--log-format", "json"},
+			`"event":"error","message":"src/site/static/en/web/index.html: broken link missing.html"`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetOptions(t)
+			if _, err := parseFlags(test.flags); err != nil {
+				t.Fatal(err)
+			}
+			project := newTestProject(t, "site")
+			web := constructWebPath(project, "site", config.Language)
+			writeFiles(t, web, map[string]string{"index.html": `<a href="missing.html">x</a>`})
+			manifestFor(project, "site").record("pagegen", filepath.Join(project, "src", "site", "pages", "index.json"),
+				filepath.Join(web, "index.html"))
+			var err error
+			output := captureOutput(t, &os.Stderr, func() {
+				err = checkPageLinks(project, "site", config.Language)
+			})
+			if (err != nil) != test.wantErr {
+				t.Errorf("error %v, want one %v", err, test.wantErr)
+			}
+			if !strings.Contains(output, test.want) {
+				t.Errorf("logged %q, want it to contain %q", output, test.want)
+			}
+		})
+	}
+}
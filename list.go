@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// listJSON makes list print json rather than text.
+var listJSON = false
+
+// listedPage is a page found by list, with its template and outputs: its
+// go file or data file, and the file building it would write. Paths are
+// relative to the project directory.
+type listedPage struct {
+	Source   string `json:"source"`
+	Template string `json:"template,omitempty"`
+	Output   string `json:"output"`
+}
+
+// listedPackage is what list found for one language of a package.
+type listedPackage struct {
+	Package   string       `json:"package"`
+	Language  string       `json:"language"`
+	Pages     []listedPage `json:"pages"`
+	Templates []listedPage `json:"templates"`
+}
+
+// listPackages prints the pages each package in args would compile and
+// generate, and where to, without running gopherjs or pagegen; the same
+// discovery as a build is used, --page included.
+func listPackages(project string, args []string) error {
+	if len(args) == 0 {
+		help()
+		return nil
+	}
+	listed := []listedPackage{}
+	for _, arg := range args {
+		found, err := listPackage(project, arg)
+		if err != nil {
+			logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+			return err
+		}
+		listed = append(listed, found...)
+	}
+	if listJSON {
+		data, err := json.MarshalIndent(listed, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	for _, pkg := range listed {
+		fmt.Printf("%s (%s)\n", pkg.Package, pkg.Language)
+		for _, page := range pkg.Pages {
+			fmt.Printf("  page %s -> %s\n", page.Source, page.Output)
+		}
+		for _, page := range pkg.Templates {
+			fmt.Printf("  html %s + %s -> %s\n", page.Source, page.Template, page.Output)
+		}
+	}
+	return nil
+}
+
+func listPackage(project string, arg string) ([]listedPackage, error) {
+	if err := validateProjectStructure(project, arg); err != nil {
+		return nil, err
+	}
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return nil, err
+	}
+	pages, err := findPages(gofiles)
+	if err != nil {
+		return nil, err
+	}
+	jsonFiles, htmlFiles, err := findTemplates(project, arg)
+	if err != nil {
+		return nil, err
+	}
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return nil, err
+	}
+	result := []listedPackage{}
+	err = forEachLanguage(langs, func(lang string) error {
+		pkg := listedPackage{Package: arg, Language: lang, Pages: []listedPage{}, Templates: []listedPage{}}
+		for _, page := range pages {
+			if pageSelected(page) {
+				pkg.Pages = append(pkg.Pages, listedPage{
+					Source: projectRelative(project, page),
+					Output: projectRelative(project, jsTarget(project, arg, lang, page)),
+				})
+			}
+		}
+		for i, jsonFile := range jsonFiles {
+			if pageSelected(jsonFile) {
+				pkg.Templates = append(pkg.Templates, listedPage{
+					Source:   projectRelative(project, jsonFile),
+					Template: projectRelative(project, htmlFiles[i]),
+					Output:   projectRelative(project, pageTarget(project, arg, lang, jsonFile)),
+				})
+			}
+		}
+		result = append(result, pkg)
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFormat is "human", the default, or "json" for one json object per
+// event, which is easier for CI to pick apart.
+var logFormat = "human"
+
+// toolOutput is "prefixed", the default, to pass on each line gopherjs,
+// pagegen or a hook prints as it comes, prefixed with the file being
+// built, or "grouped" to hold a run's lines back and print them together
+// once it finishes, so runs side by side under --jobs don't interleave.
+var toolOutput = "prefixed"
+
+var logLock sync.Mutex
+
+// logEvent is one line of --log-format json output. Event is "message",
+// "warning" or "error" for the free-form messages, "start" and "end" around each
+// gopherjs or pagegen run, "output" for a line those print, "diff" for an
+// output --diff found added, changed or removed and "summary" at the end
+// of a build.
+type logEvent struct {
+	Timestamp  string `json:"timestamp"`
+	Event      string `json:"event"`
+	Package    string `json:"package,omitempty"`
+	Step       string `json:"step,omitempty"`
+	File       string `json:"file,omitempty"`
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Change     string `json:"change,omitempty"`
+	Output     string `json:"output,omitempty"`
+	Compiled   *int   `json:"compiled,omitempty"`
+	Generated  *int   `json:"generated,omitempty"`
+	UpToDate   *int   `json:"up_to_date,omitempty"`
+}
+
+func validateLogFormat() error {
+	if logFormat != "human" && logFormat != "json" {
+		return fmt.Errorf("--log-format must be human or json, got %q", logFormat)
+	}
+	if toolOutput != "prefixed" && toolOutput != "grouped" {
+		return fmt.Errorf("--tool-output must be prefixed or grouped, got %q", toolOutput)
+	}
+	return nil
+}
+
+// logf writes a message to w, stdout for progress and stderr for problems,
+// in red when it is an error on a terminal. In json mode it becomes a
+// "message" or "error" event.
+func logf(w io.Writer, format string, args ...interface{}) {
+	logAt(w, streamSeverity(w), format, args...)
+}
+
+// logAt is logf for a message whose severity isn't just that of its
+// stream, e.g. a warning on stderr or work done on stdout. In json mode a
+// warning becomes a "warning" event.
+func logAt(w io.Writer, sev severity, format string, args ...interface{}) {
+	if logFormat == "json" {
+		event := "message"
+		message := strings.TrimPrefix(fmt.Sprintf(format, args...), "gb seven5: ")
+		switch {
+		case sev == severityWarning:
+			event = "warning"
+			message = strings.TrimPrefix(message, "warning: ")
+		case w == os.Stderr:
+			event = "error"
+		}
+		emit(w, logEvent{Event: event, Message: strings.TrimSpace(message)})
+		return
+	}
+	message := colorize(w, sev, fmt.Sprintf(format, args...))
+	logLock.Lock()
+	defer logLock.Unlock()
+	io.WriteString(w, message)
+}
+
+// filePosition matches the file:line: or file:line:col: that starts an
+// error about a place in a source or data file.
+var filePosition = regexp.MustCompile(`^(?:[A-Za-z]:)?[^\s:]+:[0-9]+(?::[0-9]+)?: `)
+
+// logError reports err, a problem found in context (e.g. a package), on
+// stderr. An error that starts with a file position is printed as just
+// file:line:col: message, which editors know how to jump to; -v keeps the
+// usual prefix and context on those too.
+func logError(context string, err error) {
+	message := err.Error()
+	switch {
+	case filePosition.MatchString(message) && !verbose:
+		logf(os.Stderr, "%s\n", message)
+	case context != "":
+		logf(os.Stderr, "gb seven5: %s: %s\n", context, message)
+	default:
+		logf(os.Stderr, "gb seven5: %s\n", message)
+	}
+}
+
+// logOutput passes on a line of output from the gopherjs or pagegen run
+// building file, prefixed with file's name in human mode. A line giving a
+// file position, like a compile error, is left as it is for editors,
+// unless -v asks for the prefix.
+func logOutput(w io.Writer, file string, line string) {
+	if logFormat == "json" {
+		emit(w, logEvent{Event: "output", File: file, Message: line})
+		return
+	}
+	if filePosition.MatchString(line) && !verbose {
+		logf(w, "%s\n", line)
+		return
+	}
+	logf(w, "[%s] %s\n", file, line)
+}
+
+// logOutputBlock passes on lines of output from the run building file as
+// they would be by logOutput, but as one block nothing else can come
+// between.
+func logOutputBlock(w io.Writer, file string, lines []string) {
+	var block bytes.Buffer
+	for _, line := range lines {
+		if logFormat == "json" {
+			block.Write(marshalEvent(logEvent{Event: "output", File: file, Message: line}))
+			continue
+		}
+		if filePosition.MatchString(line) && !verbose {
+			block.WriteString(colorize(w, streamSeverity(w), line+"\n"))
+			continue
+		}
+		block.WriteString(colorize(w, streamSeverity(w), fmt.Sprintf("[%s] %s\n", file, line)))
+	}
+	logLock.Lock()
+	defer logLock.Unlock()
+	w.Write(block.Bytes())
+}
+
+// logStepStart and logStepEnd bracket a gopherjs or pagegen run building
+// file in json mode; human mode has its own messages for these.
+func logStepStart(arg string, step string, file string) {
+	if logFormat == "json" {
+		emit(os.Stdout, logEvent{Event: "start", Package: arg, Step: step, File: file})
+	}
+}
+
+func logStepEnd(arg string, step string, file string, start time.Time, err error) {
+	if logFormat != "json" {
+		return
+	}
+	ms := time.Since(start).Nanoseconds() / int64(time.Millisecond)
+	event := logEvent{Event: "end", Package: arg, Step: step, File: file, DurationMS: &ms, Status: "ok"}
+	if err != nil {
+		event.Status = "failed"
+		event.Message = err.Error()
+	}
+	emit(os.Stdout, event)
+}
+
+func emit(w io.Writer, event logEvent) {
+	data := marshalEvent(event)
+	logLock.Lock()
+	defer logLock.Unlock()
+	w.Write(data)
+}
+
+// marshalEvent returns event as a line of json, stamped with the time.
+func marshalEvent(event logEvent) []byte {
+	event.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(event)
+	if err != nil {
+		panic(err) //only plain strings and numbers in a logEvent
+	}
+	return append(data, '\n')
+}
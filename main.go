@@ -2,208 +2,1634 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"go/ast"
+	"go/build"
 	"go/parser"
+	"go/scanner"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 var (
 	verbose = false
+	force   = false
+	jobs    = runtime.NumCPU()
+	watch   = false
+	dev     = false
+	tags    = ""
+	timeout = 5 * time.Minute
+	dryRun  = false
+	prune   = false
+
+	fingerprint = false
+	compress    = false
+
+	packagesFrom = ""
+	retries      = 0
+	outDir       = ""
+	sitemapBase  = ""
+	prettyURLs   = false
+	minify       = false
+	preBuild     = ""
+	postBuild    = ""
+	pagegenArgs  stringList
+	keepGoing    = true
+	failFast     = false
+	strict       = false
+	noHTML       = false
+	noJS         = false
+
+	//buildContext is the parent of every subprocess's context, and
+	//cancelBuild cancels it
+	buildContext = context.Background()
+	cancelBuild  = func() {}
+
+	//firstFailure is the error that stopped a --fail-fast build
+	firstFailure error
+	failureOnce  sync.Once
+
+	//maxErrors stops the build once that many pages have failed, 0 for
+	//no limit; cappedErrors are those failures
+	maxErrors    = 0
+	cappedErrors []error
+	cappedLock   sync.Mutex
+
+	flags *flag.FlagSet
+
+	//jobSlots holds a token for each gopherjs or pagegen task running
+	jobSlots chan struct{}
+
+	errInterrupted = errors.New("interrupted")
+
+	//allowOrphanJSON makes a data file without an html file a warning
+	allowOrphanJSON = false
+	errNoTemplate   = errors.New("no html file")
 )
 
+// retryBackoff is how long to wait before the first --retries attempt;
+// each later attempt waits that much longer again.
+const retryBackoff = time.Second
+
 func main() {
+	//gb sets GB_PROJECT_DIR; run directly, look for the project instead
 	project := os.Getenv("GB_PROJECT_DIR")
-
-	//sanity
 	if project == "" {
-		panic("gb extensions should be launched with GB_PROJECT_DIR set")
+		var err error
+		if project, err = findProjectDir(); err != nil {
+			logf(os.Stderr, "gb seven5: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	project, err := canonicalProjectDir(project)
+	if err != nil {
+		logf(os.Stderr, "gb seven5: bad project directory: %v\n", err)
+		os.Exit(1)
+	}
+	//ctrl-c kills any running gopherjs or pagegen; signals after the
+	//first just cancel again, which is harmless
+	ctx, cancel := context.WithCancel(context.Background())
+	buildContext, cancelBuild = ctx, cancel
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range signals {
+			cancel()
+		}
+	}()
+
+	err = run(project, os.Args[1:])
+	if err != nil || (ctx.Err() != nil && !watch) {
+		os.Exit(1)
+	}
+}
+
+// run parses the command line in args and builds (or cleans) each package
+// it names, continuing past failures so that every broken package is
+// reported. Problems are printed as they are found; the returned error
+// summarizes them.
+func run(project string, args []string) error {
+	args, testArgs = splitTestArgs(args)
+	args, err := parseFlags(args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		return err
+	}
+	defer stopProfiling()
+	if config, err = loadConfig(project); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	if packagesFrom != "" {
+		listed, err := readPackageList(packagesFrom)
+		if err != nil {
+			logf(os.Stderr, "unable to read package list %s: %v\n", packagesFrom, err)
+			return err
+		}
+		args = append(args, listed...)
+	}
+	if args, err = expandPackageSpecs(project, args); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	if len(args) > 0 && args[0] == "clean" {
+		return cleanPackages(project, args[1:])
+	}
+	if len(args) > 0 && args[0] == "version" {
+		return printVersions(project)
+	}
+	//check and list don't run gopherjs or pagegen, so don't need them
+	if len(args) > 0 && args[0] == "check" {
+		return checkPackages(project, args[1:])
+	}
+	if len(args) > 0 && args[0] == "list" {
+		return listPackages(project, args[1:])
+	}
+	if len(args) > 0 && args[0] == "test" {
+		return testPackages(project, args[1:])
+	}
+	if len(testArgs) > 0 {
+		err := errors.New("arguments after -- are only for the test subcommand")
+		logf(os.Stderr, "%v\n", err)
+		return err
 	}
 	//validate that gopherjs, pagegen are there
 	if err := validateExecutablesInPath(project); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		logf(os.Stderr, "%v\n", err)
+		return err
 	}
-	//figure out args, if any
-	args := os.Args[1:]
 	if len(args) == 0 {
 		help()
-		os.Exit(0)
+		return nil
+	}
+	if args[0] == "serve" {
+		return servePackage(project, args[1:])
+	}
+
+	if changedSince != "" {
+		if args = changedPackages(project, args, changedSince); len(args) == 0 {
+			return nil
+		}
+	}
+	//a manifest is of one package, so one is compared with it
+	if diffAgainst != "" && len(args) != 1 {
+		err := fmt.Errorf("--diff-against compares the build of one package, got %d", len(args))
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	if archivePath != "" && len(args) != 1 {
+		err := fmt.Errorf("--archive packs the build of one package, got %d", len(args))
+		logf(os.Stderr, "%v\n", err)
+		return err
 	}
 
 	//walk each arg, assuming that they are golang package specs
+	start := time.Now()
+	errs := buildPackages(project, args)
+	if firstFailure != nil {
+		logf(os.Stderr, "gb seven5: stopped at the first failure (--fail-fast): %v\n", firstFailure)
+		return firstFailure
+	}
+	if errorCapReached() {
+		for _, err := range cappedErrors {
+			logError("", err)
+		}
+		err := fmt.Errorf("stopped after %d error(s) (--max-errors)", maxErrors)
+		logf(os.Stderr, "gb seven5: ...and possibly more, %v\n", err)
+		return err
+	}
+	if buildContext.Err() != nil {
+		logf(os.Stderr, "gb seven5: interrupted\n")
+		return errInterrupted
+	}
+	if len(errs) > 0 {
+		logPackageErrors(errs)
+		err = fmt.Errorf("%d of %d packages failed", len(errs), len(args))
+		logf(os.Stderr, "gb seven5: %v\n", err)
+	}
+	//nothing ran under --dry-run, so there is nothing to time
+	if !dryRun {
+		printTimingSummary(time.Since(start))
+	}
+	warnCommonImports()
+	if diffAgainst != "" && len(errs) == 0 {
+		if err := printManifestDiff(project, args[0], diffAgainst); err != nil {
+			logf(os.Stderr, "unable to compare with %s: %v\n", diffAgainst, err)
+			return err
+		}
+	}
+	if archivePath != "" && len(errs) == 0 {
+		if err := writeArchive(project, args[0], archivePath); err != nil {
+			logf(os.Stderr, "unable to write archive %s: %v\n", archivePath, err)
+			return err
+		}
+	}
+	if watch {
+		return watchPackages(project, args)
+	}
+	return err
+}
+
+// packageError is the error building a package failed with.
+type packageError struct {
+	arg string
+	err error
+}
+
+func (e *packageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.arg, e.err)
+}
+
+// logPackageErrors reports the errors of buildPackages.
+func logPackageErrors(errs []error) {
+	for _, err := range errs {
+		if e, ok := err.(*packageError); ok {
+			logError(e.arg, e.err)
+			continue
+		}
+		logError("", err)
+	}
+}
+
+// buildPackages builds the packages in args side by side, since they are
+// independent, and returns their errors in args order. The gopherjs and
+// pagegen runs within them all draw on the one --jobs budget.
+func buildPackages(project string, args []string) []error {
+	results := make([]error, len(args))
+	workers := jobs
+	if dryRun {
+		workers = 1 //keeps the printed commands in a stable order
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, arg := range args {
+		if buildContext.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, arg string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := buildPackage(project, arg); err != nil {
+				results[i] = &packageError{arg, err}
+				failed(results[i])
+			}
+		}(i, arg)
+	}
+	wg.Wait()
+	errs := []error{}
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// hookCommand returns the hook command given by its flag, if any, else the
+// one from the config.
+func hookCommand(flagValue string, configValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return configValue
+}
+
+// parseFlags sets the option variables from args and returns the remaining
+// arguments: an optional subcommand followed by package specs.
+func parseFlags(args []string) ([]string, error) {
+	flags = flag.NewFlagSet("gb seven5", flag.ContinueOnError)
+	flags.Usage = help
+	flags.BoolVar(&verbose, "v", false, "verbose: list the templates found and time each gopherjs and pagegen run")
+	flags.BoolVar(&force, "force", false, "rebuild everything, ignoring modification times")
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of pages to build concurrently, across all packages")
+	flags.BoolVar(&watch, "watch", false, "stay running and rebuild when sources change")
+	flags.BoolVar(&dev, "dev", false, "debug build: skip minification and generate source maps")
+	flags.StringVar(&buildProfile, "profile", "", "dev for --dev without --minify-html, --fingerprint or --compress, prod for all three without --dev; flags given as well win")
+	flags.StringVar(&tags, "tags", "", "space-separated build tags passed to gopherjs, with or without --dev")
+	flags.BoolVar(&dryRun, "dry-run", false, "print the gopherjs and pagegen commands that would run, without running them")
+	flags.BoolVar(&noHTML, "no-html", false, "only compile the javascript, leaving the html as it is")
+	flags.BoolVar(&noJS, "no-js", false, "only generate the html, leaving the javascript as it is")
+	flags.BoolVar(&failOnOrphanHTML, "fail-on-orphan-html", false, "fail if an html template has no data file or front matter, so no page uses it")
+	flags.BoolVar(&allowOrphanJSON, "allow-orphan-json", false, "skip, with a warning, data files that have no html file instead of failing")
+	flags.BoolVar(&prune, "prune", false, "delete previously generated files that the build no longer produces")
+	flags.BoolVar(&fingerprint, "fingerprint", false, "also write each page's javascript under a content-hashed name and point the html at it")
+	flags.BoolVar(&compress, "compress", false, "write a gzipped .gz beside each javascript and html output worth compressing")
+	flags.StringVar(&packagesFrom, "packages-from", "", "also build the package specs listed in this file, one per line (- for stdin)")
+	flags.StringVar(&logFormat, "log-format", "human", "human, or json for one json object per log event")
+	flags.BoolVar(&listJSON, "json", false, "with list, print json rather than text")
+	flags.StringVar(&cpuProfile, "cpuprofile", "", "write a cpu profile of gb seven5 itself to this file")
+	flags.StringVar(&traceFile, "trace", "", "write an execution trace of gb seven5 itself to this file")
+	flags.StringVar(&changedSince, "changed-since", "", "only build the packages with changes since this git revision, and those whose client code imports something changed")
+	flags.StringVar(&archivePath, "archive", "", "after the build, also pack the package's static directory into this .tar, .tar.gz, .tgz or .zip")
+	flags.StringVar(&diffAgainst, "diff-against", "", "after the build, print the outputs added, changed or removed since the one that wrote this manifest")
+	flags.StringVar(&toolOutput, "tool-output", "prefixed", "prefixed to stream the tools' output a line at a time, or grouped to print each run's output together when it ends")
+	flags.IntVar(&retries, "retries", 0, "retry a gopherjs run that fails without a compile error up to this many times")
+	flags.StringVar(&preBuild, "pre-build", "", "shell command to run for each package before it is built (overrides pre_build in "+configName+")")
+	flags.StringVar(&postBuild, "post-build", "", "shell command to run for each package after it is built (overrides post_build in "+configName+")")
+	pagegenArgs = nil
+	flags.Var(&pagegenArgs, "pagegen-arg", "pass this argument to pagegen as is, after the ones gb seven5 gives it (repeatable)")
+	selectedPages = nil
+	flags.Var(&selectedPages, "page", "only build the page or template with this base name, e.g. about for client/about.go (repeatable)")
+	languages = nil
+	flags.Var(&languages, "lang", "only build this language, e.g. fr for static/fr/web, instead of every one found (repeatable)")
+	flags.BoolVar(&followSymlinks, "follow-symlinks", false, "also look for sources and templates in symlinked directories")
+	flags.StringVar(&outDir, "out", "", "write each package's output to DIR/<package> instead of its static directory")
+	for _, option := range gopherjsOptions {
+		flags.BoolVar(option.set, option.name, false, option.usage)
+	}
+	flags.StringVar(&ldflags, "ldflags", "", "-X importpath.name=value settings for gopherjs build; -X is the only linker flag with a meaning for javascript")
+	flags.StringVar(&buildID, "build-id", "", "set main.BuildID to this in each page, e.g. to tie a browser error to its build")
+	flags.BoolVar(&trimPath, "trim-path", false, "make the absolute source paths in the source maps relative to the project (needs --dev)")
+	flags.StringVar(&sourceMapRoot, "source-map-root", "", "set this sourceRoot in the source maps, e.g. a CDN URL (needs --dev)")
+	flags.StringVar(&sitemapBase, "sitemap", "", "write a sitemap.xml of the generated pages, with URLs under this base URL")
+	flags.BoolVar(&prettyURLs, "pretty-urls", false, "generate about.html as about/index.html, to be served as /about/")
+	flags.StringVar(&dataFilter, "data-filter", "", "shell command that each page's json is piped through before pagegen gets it")
+	flags.BoolVar(&inlineJS, "inline-js", false, "put each page's compiled javascript in the html instead of linking to it")
+	flags.IntVar(&inlineLimit, "inline-js-limit", 16*1024, "with --inline-js, keep linking to javascript bigger than this many bytes")
+	flags.BoolVar(&checkLinks, "check-links", false, "warn of local href and src references in the generated html that name no output file (an error with --strict)")
+	flags.BoolVar(&validateHTML, "validate-html", false, "fail a page whose generated html has unclosed or mismatched tags")
+	flags.BoolVar(&minify, "minify-html", false, "strip comments and collapse whitespace in the generated html")
+	flags.BoolVar(&keepGoing, "keep-going", true, "build everything that can be built, reporting every failure at the end")
+	flags.StringVar(&gopherjsCache, "gopherjs-cache", "", "the directory gopherjs compiles share their compiled packages through (default <project>/pkg/gopherjs-cache)")
+	flags.BoolVar(&strict, "strict", false, "fail a page whose gopherjs build prints any warnings, and a package with no pages or no html")
+	flags.IntVar(&maxErrors, "max-errors", 0, "stop the build once this many pages have failed, reporting just those (0 for no limit)")
+	flags.BoolVar(&failFast, "fail-fast", false, "stop the whole build at the first failure, cancelling the work in progress")
+	flags.StringVar(&serveAddr, "addr", ":8080", "with serve, the address to listen on")
+	flags.DurationVar(&timeout, "timeout", 5*time.Minute, "kill a gopherjs or pagegen process that runs longer than this (0 for no limit)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := flags.Args()
+	//flags may also follow a subcommand, e.g. "gb seven5 clean -v mypkg"
+	if len(rest) > 0 && isSubcommand(rest[0]) {
+		command := rest[0]
+		if err := flags.Parse(rest[1:]); err != nil {
+			return nil, err
+		}
+		rest = append([]string{command}, flags.Args()...)
+	}
+	if err := applyBuildProfile(flags); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if jobs < 1 {
+		err := fmt.Errorf("--jobs must be at least 1, got %d", jobs)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	keepGoingSet := false
+	flags.Visit(func(f *flag.Flag) { keepGoingSet = keepGoingSet || f.Name == "keep-going" })
+	if failFast && keepGoing && keepGoingSet {
+		err := errors.New("--fail-fast and --keep-going contradict each other")
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	failFast = failFast || !keepGoing
+	if noHTML && noJS {
+		err := errors.New("--no-html and --no-js together leave nothing to build")
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if archivePath != "" {
+		if _, err := archiveFormat(archivePath); err != nil {
+			logf(os.Stderr, "%v\n", err)
+			return nil, err
+		}
+		if dryRun || watch {
+			err := errors.New("--archive can't be used with --dry-run or --watch, it packs the outputs of one finished build")
+			logf(os.Stderr, "%v\n", err)
+			return nil, err
+		}
+	}
+	if diffAgainst != "" && dryRun {
+		err := errors.New("--diff-against can't be used with --dry-run, which writes no manifest")
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if maxErrors < 0 {
+		err := fmt.Errorf("--max-errors must not be negative, got %d", maxErrors)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if maxErrors > 0 && watch {
+		err := errors.New("--max-errors can't be used with --watch, which has to carry on after a failure")
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if failFast && watch {
+		err := errors.New("--fail-fast can't be used with --watch, which has to carry on after a failure")
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if retries < 0 {
+		err := fmt.Errorf("--retries must not be negative, got %d", retries)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if inlineLimit < 0 {
+		err := fmt.Errorf("--inline-js-limit must not be negative, got %d", inlineLimit)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if outDir != "" {
+		abs, err := filepath.Abs(outDir)
+		if err != nil {
+			logf(os.Stderr, "bad --out directory %s: %v\n", outDir, err)
+			return nil, err
+		}
+		outDir = abs
+	}
+	if err := validateGopherjsOptions(); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if err := validatePagegenArgs(pagegenArgs); err != nil {
+		err = fmt.Errorf("--pagegen-arg: %v", err)
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	if sitemapBase != "" {
+		if err := validateSitemapBase(sitemapBase); err != nil {
+			logf(os.Stderr, "%v\n", err)
+			return nil, err
+		}
+	}
+	if err := validateLogFormat(); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return nil, err
+	}
+	slots := jobs
+	if dryRun {
+		slots = 1 //keeps the printed commands in a stable order
+	}
+	jobSlots = make(chan struct{}, slots)
+	return rest, nil
+}
+
+// readPackageList returns the package specs in the file at path, or on
+// stdin if path is "-": one per line, ignoring blank lines and anything
+// after a #.
+func readPackageList(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	specs := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			specs = append(specs, line)
+		}
+	}
+	return specs, nil
+}
+
+// expandPackageSpecs replaces each arg ending in "..." with every package
+// under that prefix that has a client directory, like the go tool does.
+// Other args, including a leading subcommand, are passed through as is.
+func expandPackageSpecs(project string, args []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
 	for _, arg := range args {
+		if arg != "..." && !strings.HasSuffix(arg, "/...") {
+			if !seen[arg] {
+				result = append(result, arg)
+				seen[arg] = true
+			}
+			continue
+		}
+		prefix := strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+		if err := validatePackageSpec(project, prefix+"/x"); err != nil {
+			return nil, err
+		}
+		src := constructSourcePath(project)
+		root := filepath.Join(src, filepath.FromSlash(prefix))
+		found := false
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			name := info.Name()
+			if path != root && (name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			client, err := os.Stat(filepath.Join(path, config.Layout.ClientDir))
+			if err != nil || !client.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			pkg := filepath.ToSlash(rel)
+			if !seen[pkg] {
+				result = append(result, pkg)
+				seen[pkg] = true
+			}
+			found = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand %s: %v", arg, err)
+		}
+		if !found {
+			return nil, fmt.Errorf("no packages with a %s directory match %s", config.Layout.ClientDir, arg)
+		}
+	}
+	return result, nil
+}
 
-		//make sure everything is where we expect within arg
-		if err := validateProjectStructure(project, arg); err != nil {
-			os.Exit(1)
+func isSubcommand(name string) bool {
+	switch name {
+	case "clean", "check", "list", "serve", "test", "version":
+		return true
+	}
+	return false
+}
+
+func buildPackage(project string, arg string) error {
+	//make sure everything is where we expect within arg
+	if err := validateProjectStructure(project, arg); err != nil {
+		return err
+	}
+
+	if len(selectedPages) > 0 {
+		if err := validateSelectedPages(project, arg); err != nil {
+			return err
 		}
+	}
 
-		//gopherjs creates the js code
-		if err := gopherjsCompilation(project, arg); err != nil {
-			os.Exit(1)
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return err
+	}
+	if outDir != "" && !dryRun {
+		err := forEachLanguage(langs, func(lang string) error {
+			if err := os.MkdirAll(constructWebPath(project, arg, lang), 0755); err != nil {
+				logf(os.Stderr, "unable to create output directory: %v\n", err)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		//pagegen creates the HTML pages
-		if err := pageGeneration(project, arg); err != nil {
-			os.Exit(1)
+	//e.g. generated go sources have to be in place before compiling; the
+	//hooks get the first language's output directory, so it is the same
+	//with and without several languages
+	if hook := hookCommand(preBuild, config.PreBuild); hook != "" {
+		if err := runHook(project, arg, langs[0], "pre-build", hook); err != nil {
+			return err
+		}
+	}
+
+	//each language has its own web directory, with its own copy of the
+	//javascript
+	if err := forEachLanguage(langs, func(lang string) error {
+		return buildLanguage(project, arg, lang)
+	}); err != nil {
+		return err
+	}
+
+	//the user's own steps, e.g. bundling, run on the finished output
+	if hook := hookCommand(postBuild, config.PostBuild); hook != "" {
+		if err := runHook(project, arg, langs[0], "post-build", hook); err != nil {
+			return err
+		}
+	}
+
+	//only a complete build replaces the previous manifest
+	if dryRun {
+		return nil
+	}
+	if compress {
+		if err := compressOutputs(project, arg); err != nil {
+			return err
+		}
+	}
+	//a --lang build leaves the other languages as they were
+	if len(languages) > 0 {
+		if err := keepOtherLanguages(project, arg, langs); err != nil {
+			return err
+		}
+	}
+	if err := checkOrphans(project, arg); err != nil {
+		return err
+	}
+	return writeManifest(project, arg)
+}
+
+// buildLanguage compiles the javascript and generates the pages of arg's
+// lang into lang's web directory. Unless --fail-fast, pages whose
+// javascript failed to compile don't stop the html from being generated;
+// both failures are returned.
+func buildLanguage(project string, arg string, lang string) error {
+	//gopherjs creates the js code
+	var compileErr error
+	if noJS {
+		steps := []string{"gopherjs"}
+		if fingerprint {
+			steps = append(steps, "fingerprint")
+		}
+		compileErr = keepSkippedOutputs(project, arg, lang, steps...)
+	} else {
+		compileErr = gopherjsCompilation(project, arg, lang)
+	}
+	if compileErr != nil && (failFast || buildContext.Err() != nil) {
+		return compileErr
+	}
+
+	//pagegen creates the HTML pages
+	var err error
+	if noHTML {
+		err = keepSkippedOutputs(project, arg, lang, "pagegen")
+	} else {
+		err = pageGeneration(project, arg, lang)
+	}
+	if err != nil {
+		if compileErr != nil {
+			return fmt.Errorf("%v; %v", compileErr, err)
+		}
+		return err
+	}
+	if compileErr != nil {
+		return compileErr
+	}
+
+	//the pages no longer refer to fingerprinted scripts
+	if !fingerprint && !dryRun {
+		if err := os.Remove(constructRevManifestPath(project, arg, lang)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if sitemapBase != "" && !dryRun {
+		if err := writeSitemap(project, arg, lang, sitemapBase); err != nil {
+			return err
+		}
+	}
+
+	//some support files are served as well as included
+	if err := copySupportAssets(project, arg, lang); err != nil {
+		return err
+	}
+	if checkLinks && !dryRun {
+		return checkPageLinks(project, arg, lang)
+	}
+	return nil
+}
+
+func pageGeneration(project string, arg string, lang string) error {
+	present := false
+	for _, root := range constructTemplateRoots(project, arg) {
+		if _, err := os.Stat(root); err == nil {
+			present = true
+		}
+	}
+	if !present {
+		logAt(os.Stdout, severitySkipped, "gb seven5: no pages directory %s, no html to generate\n",
+			strings.Join(constructTemplateRoots(project, arg), ", "))
+		return nil
+	}
+	jsonFiles, htmlFiles, err := findTemplates(project, arg)
+	if err != nil {
+		return err
+	}
+	if len(jsonFiles) == 0 {
+		problem := fmt.Sprintf("no data file or front matter page in %s, so there is no html to generate",
+			strings.Join(constructTemplateRoots(project, arg), ", "))
+		if err := nothingToBuild(arg, problem); err != nil {
+			return err
+		}
+	}
+	if failOnOrphanHTML {
+		if errs := orphanTemplates(project, arg, jsonFiles, htmlFiles); len(errs) > 0 {
+			for _, err := range errs {
+				logf(os.Stderr, "%v\n", err)
+			}
+			return fmt.Errorf("%d html templates without a page", len(errs))
+		}
+	}
+	revs := map[string]string{}
+	if fingerprint && !dryRun {
+		if revs, err = readRevManifest(project, arg, lang); err != nil {
+			logf(os.Stderr, "unable to read %s: %v\n", constructRevManifestPath(project, arg, lang), err)
+			return err
 		}
 	}
+	scripts := compiledScripts(project, arg, lang)
+	languageRefs := languageScriptRefs(project, arg, lang)
+	scriptFiles := []string{}
+	for _, script := range scripts {
+		scriptFiles = append(scriptFiles, script)
+	}
+	sort.Strings(scriptFiles)
+	support, err := supportDigest(project, arg)
+	if err != nil {
+		logf(os.Stderr, "unable to read support directory: %v\n", err)
+		return err
+	}
+	supportDir, cleanup, err := prepareSupport(project, arg, lang)
+	if err != nil {
+		logf(os.Stderr, "unable to merge support directories: %v\n", err)
+		return err
+	}
+	defer cleanup()
+	cache := loadPageCache(project, arg, lang)
+	targets := targetSet{}
+	for _, jsonFile := range jsonFiles {
+		if err := targets.claim(pageTarget(project, arg, lang, jsonFile), jsonFile); err != nil {
+			return err
+		}
+	}
+
+	tasks := []func() error{}
+	for i, jsonFile := range jsonFiles {
+		//pagegen takes both relative to --dir, the page's template root,
+		//with a leading separator; the template may be in another root
+		root := templateRootOf(project, arg, jsonFile)
+		html := string(filepath.Separator) + relativePath(root, htmlFiles[i])
+		json := string(filepath.Separator) + relativePath(root, jsonFile)
+		includes := config.Layout.SupportDir
+		if supportDir != "" {
+			includes = relativePath(root, supportDir)
+		}
+		out := pageTarget(project, arg, lang, jsonFile)
+		if !pageSelected(jsonFile) {
+			keepUnselected(project, arg, "pagegen", jsonFile, out)
+			cache.keep(out)
+			continue
+		}
+
+		overlay := translationFor(jsonFile, lang)
+		inputs := []string{htmlFiles[i], jsonFile}
+		if overlay != "" {
+			inputs = append(inputs, overlay)
+		}
+		//pages must be regenerated when the fingerprints, or whether
+		//there are any, change
+		if fingerprint {
+			inputs = append(inputs, constructRevManifestPath(project, arg, lang))
+		}
+		//which scripts a page refers to is only known once it is
+		//generated, so any of them changing may change an inlined page
+		if inlineJS {
+			inputs = append(inputs, scriptFiles...)
+		}
+		//see supportDigest for why support files count for every page
+		extra := []string{"support=" + support,
+			fmt.Sprint("fingerprint=", fingerprint), fmt.Sprint("minify=", minify),
+			fmt.Sprint("inline-js=", inlineJS, " ", inlineLimit),
+			fmt.Sprint("validate-html=", validateHTML),
+			fmt.Sprintf("pagegen-args=%q %q", config.PagegenArgs, pagegenArgs)}
+		//a page that refers to an environment variable changes with it
+		hash, err := hashInputs(inputs, append(extra, envInputs(inputs)...)...)
+		//what a data filter computes can't be known without running it
+		rebuild := force || dataFilter != "" || err != nil || !cache.fresh(out, hash)
+		if !rebuild {
+			recordSkip(out)
+			manifestFor(project, arg).record("pagegen", jsonFile, out)
+			cache.set(out, hash)
+			continue //no point in running pagegen
+		}
+		jsonFile, template := jsonFile, htmlFiles[i]
+		tasks = append(tasks, func() (err error) {
+			start := time.Now()
+			logStepStart(arg, "pagegen", jsonFile)
+			defer func() { logStepEnd(arg, "pagegen", jsonFile, start, err) }()
+			logAt(os.Stdout, severityDone, "gb seven5: rebuilding %s\n", out)
+			//pagegen's own complaint about bad json doesn't say where
+			data, err := readDataFile(jsonFile)
+			if err != nil {
+				return err
+			}
+			//pagegen only reads the json file, so yaml, merged, expanded or
+			//filtered data is handed over in a scratch one beside out, as
+			//is a template less its front matter
+			frontMatter := hasFrontMatter(template)
+			scratch := ""
+			if (isYAMLFile(jsonFile) || overlay != "" || frontMatter || usesEnv(jsonFile) || dataFilter != "") && !dryRun {
+				if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+					return err
+				}
+				if scratch, err = ioutil.TempDir(filepath.Dir(out), ".seven5-"); err != nil {
+					return err
+				}
+				defer os.RemoveAll(scratch)
+			}
+			//front matter is the template's default data, a data file
+			//beside it wins where both give a value
+			if frontMatter {
+				front, err := readDataFile(template)
+				if err != nil {
+					return err
+				}
+				data = mergeData(front, data)
+				if scratch != "" {
+					body := filepath.Join(scratch, filepath.Base(template))
+					if err := writeTemplateBody(template, body); err != nil {
+						return err
+					}
+					html = string(filepath.Separator) + relativePath(root, body)
+				}
+			}
+			if overlay != "" {
+				translated, err := readDataFile(overlay)
+				if err != nil {
+					return err
+				}
+				data = mergeData(data, translated)
+			}
+			if dataFilter != "" && !dryRun {
+				if data, err = filterData(project, arg, lang, jsonFile, data); err != nil {
+					return err
+				}
+			}
+			if scratch != "" {
+				tmp := filepath.Join(scratch, strings.TrimSuffix(filepath.Base(jsonFile), filepath.Ext(jsonFile))+".json")
+				if err := writeDataJSON(tmp, data); err != nil {
+					return err
+				}
+				json = string(filepath.Separator) + relativePath(root, tmp)
+			}
+			if err := launchPagegen(buildContext, includes, root, html, json, out); err != nil {
+				return err
+			}
+			//pages name the plain scripts, which are another language's
+			if len(languageRefs) > 0 && !dryRun {
+				if err := rewriteScriptRefs(project, arg, lang, out, languageRefs); err != nil {
+					return err
+				}
+			}
+			//inlined scripts no longer need their fingerprinted names
+			if inlineJS && !dryRun {
+				if err := inlineScripts(project, arg, lang, out, scripts); err != nil {
+					return err
+				}
+			}
+			if fingerprint && !dryRun {
+				if err := rewriteScriptRefs(project, arg, lang, out, revs); err != nil {
+					return err
+				}
+			}
+			recordTiming("pagegen", out, start)
+			manifestFor(project, arg).record("pagegen", jsonFile, out)
+			if hash != "" {
+				cache.set(out, hash)
+			}
+			return nil
+		})
+	}
+	errs := forEachParallel(tasks)
+	//the pages that did build are still worth remembering
+	if !dryRun {
+		if err := cache.save(); err != nil {
+			logf(os.Stderr, "unable to write %s: %v\n", cache.path, err)
+			return err
+		}
+	}
+	return reportTaskErrors("generate", errs, len(tasks))
+}
+
+// findTemplates walks the template roots in order and returns each json
+// or yaml data file along with the html template that it drives. A page in
+// a later root replaces the one at the same path, ignoring the extension,
+// in an earlier root.
+func findTemplates(project string, arg string) ([]string, []string, error) {
+	roots := constructTemplateRoots(project, arg)
+	ignore := ignoresFor(project, arg)
+	jsonFiles := []string{}
+	htmlFiles := []string{}
+	pages := map[string]int{} //page name to its index in jsonFiles
+	for _, templatePath := range roots {
+		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
+			continue
+		}
+		add := func(json string, html string) {
+			rel := relativePath(templatePath, json)
+			name := strings.TrimSuffix(rel, filepath.Ext(rel))
+			if i, ok := pages[name]; ok && templateRootOf(project, arg, jsonFiles[i]) != templatePath {
+				if verbose {
+					logf(os.Stdout, "gb seven5: %s overrides %s\n", json, jsonFiles[i])
+				}
+				jsonFiles[i], htmlFiles[i] = json, html
+				return
+			}
+			pages[name] = len(jsonFiles)
+			jsonFiles = append(jsonFiles, json)
+			htmlFiles = append(htmlFiles, html)
+		}
+		err := walkTree(templatePath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				logf(os.Stderr, "error walking %s: %v\n", path, err)
+				return err
+			}
+			if skip, err := ignore.skip(path, info); skip {
+				return err
+			}
+			//ignore the support dir
+			if info.IsDir() && (info.Name() == config.Layout.SupportDir || path == filepath.Join(templatePath, config.Layout.SupportDir)) {
+				return filepath.SkipDir
+			}
+			//make sure that for each json (or yaml) there is an HTML
+			if !info.IsDir() && isDataFile(info.Name()) {
+				if err := checkSingleDataFile(path); err != nil {
+					logf(os.Stderr, "%v\n", err)
+					return err
+				}
+				//locale overlays are merged into their base data, not pages
+				if isOverlay(path) {
+					return nil
+				}
+				html, err := templateFor(roots, path)
+				if err == errNoTemplate {
+					return nil //a data fragment, not a page
+				}
+				if err != nil {
+					return err
+				}
+				add(path, html)
+			}
+			//a template with front matter is a page, and is its own data, when
+			//no data file beside it gives the page's data instead
+			if !info.IsDir() && filepath.Ext(path) == ".html" && hasFrontMatter(path) && dataFileFor(path) == "" {
+				add(path, path)
+			}
+			return nil
+		})
+		if err != nil {
+			logf(os.Stderr, "Unable to walk directory %s: %v\n", templatePath, err)
+			return nil, nil, err
+		}
+	}
+	//overrides land where the page they replace was found, so put the
+	//pages back in path order, keeping each with its template
+	order := make([]int, len(jsonFiles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return jsonFiles[order[i]] < jsonFiles[order[j]] })
+	sortedJSON, sortedHTML := make([]string, len(order)), make([]string, len(order))
+	for i, j := range order {
+		sortedJSON[i], sortedHTML[i] = jsonFiles[j], htmlFiles[j]
+	}
+	jsonFiles, htmlFiles = sortedJSON, sortedHTML
+
+	if verbose {
+		for i, json := range jsonFiles {
+			jsonShort := relativePath(constructPagesPath(project, arg), json)
+			htmlShort := relativePath(constructPagesPath(project, arg), htmlFiles[i])
+			logf(os.Stdout, "%d %s %s\n", i, jsonShort, htmlShort)
+		}
+	}
+	return jsonFiles, htmlFiles, nil
+}
+
+// templateFor returns the html template driven by the data file at path.
+// By default that is the html file of the same name beside it, but a data
+// object with a "_template" key names its template instead, relative to the
+// template roots, so that many data files can share one template. The
+// last root that has it wins.
+//
+// A data file with no template of its own is an error, unless
+// --allow-orphan-json is given; then the error is errNoTemplate and has
+// already been logged as a warning. So is one that can't be read or
+// parsed, whatever its template.
+func templateFor(roots []string, path string) (string, error) {
+	html := strings.TrimSuffix(path, filepath.Ext(path)) + ".html"
+	name, named, err := templateKey(path)
+	if err != nil {
+		return "", err
+	}
+	if named {
+		if err := validateRelativeDir(name); err != nil {
+			logf(os.Stderr, "bad _template in data file %s: %v\n", path, err)
+			return "", err
+		}
+		for _, root := range roots {
+			candidate := filepath.Join(root, filepath.FromSlash(name))
+			if _, err := os.Stat(candidate); err == nil || root == roots[0] {
+				html = candidate
+			}
+		}
+	}
+	if _, err := os.Stat(html); err != nil && allowOrphanJSON && !named {
+		logAt(os.Stderr, severityWarning, "gb seven5: warning: skipping data file %s, it has no html file\n", path)
+		return "", errNoTemplate
+	}
+	if _, err := os.Stat(html); err != nil {
+		logf(os.Stderr, "unable to find corresponding html file for data file %s\n", path)
+		return "", fmt.Errorf("no html file for %s", path)
+	}
+	return html, nil
+}
+
+// templateKey returns the "_template" string of the data object at path,
+// if it has one, or the error reading or parsing path.
+func templateKey(path string) (string, bool, error) {
+	data, err := readDataFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return "", false, nil
+	}
+	name, ok := fields["_template"].(string)
+	return name, ok, nil
+}
+
+func fileAfter(path string, crit time.Time) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return info.ModTime().After(crit)
+}
+
+func anyDirectoryContentAfter(path string, crit time.Time) bool {
+	result := false
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !result && info.ModTime().After(crit) {
+			result = true
+
+		}
+		return nil
+	})
+	if err != nil {
+		return true
+	}
+	return result
+}
+
+func gopherjsCompilation(project string, arg string, lang string) error {
+	//this the full path to the package from arg
+	dir := constructClientPackagePath(project, arg)
+
+	//find the gofiles in the package
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{dir})
+	if err != nil {
+		return err
+	}
+
+	//find the gofiles that have a main()
+	pages, err := findPages(gofiles)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		problem := fmt.Sprintf("no go file in %s has a main func, so there is no javascript to compile", dir)
+		if err := nothingToBuild(arg, problem); err != nil {
+			return err
+		}
+	}
+	return compilePages(project, arg, lang, pages)
+}
+
+func findPages(gofiles []string) ([]string, error) {
+	pages := []string{}
+	for _, gofile := range gofiles {
+		hasMain, err := hasMainFunc(gofile)
+		if err != nil {
+			return nil, err
+		}
+		if hasMain {
+			pages = append(pages, gofile)
+		}
+	}
+	return pages, nil
+}
+
+// mainPackageFiles returns the go files of page's package when page, a go
+// file with a main func, is one of several package main files in its
+// directory and the only one of them with a main: gopherjs then has to
+// compile the whole package to get them all. Otherwise it returns nil and
+// page is compiled on its own, as each main file of a directory of them is.
+func mainPackageFiles(page string) []string {
+	dir := filepath.Dir(page)
+	ctx := gopherjsContext()
+	pkg, err := ctx.ImportDir(dir, 0)
+	if err != nil || pkg.Name != "main" || len(pkg.GoFiles) < 2 {
+		return nil
+	}
+	files := []string{}
+	mains := 0
+	for _, name := range pkg.GoFiles {
+		file := filepath.Join(dir, name)
+		if hasMain, err := hasMainFunc(file); err == nil && hasMain {
+			mains++
+		}
+		files = append(files, file)
+	}
+	if mains != 1 {
+		return nil
+	}
+	return files
+}
+
+// pageSources returns the go files compiled into page's javascript.
+func pageSources(page string) []string {
+	if files := mainPackageFiles(page); files != nil {
+		return files
+	}
+	return []string{page}
+}
+
+// compileSource returns what to hand gopherjs to compile page: the import
+// path of its package if the whole package makes up the page, otherwise
+// the file itself.
+func compileSource(project string, page string) string {
+	if mainPackageFiles(page) == nil {
+		return page
+	}
+	return filepath.ToSlash(relativePath(constructSourcePath(project), filepath.Dir(page)))
+}
+
+func compilePages(project string, arg string, lang string, pages []string) error {
+	//refuse to build at all rather than let one page overwrite another
+	targets := targetSet{}
+	for _, page := range pages {
+		if err := targets.claim(jsTarget(project, arg, lang, page), page); err != nil {
+			return err
+		}
+	}
+	tasks := []func() error{}
+	commonDir := ""
+	if config.CommonPackage != "" {
+		dir, err := commonPackageDir(project)
+		if err != nil {
+			logf(os.Stderr, "%v\n", err)
+			return err
+		}
+		commonDir = dir
+		target := commonTarget(project, arg, lang)
+		if err := targets.claim(target, config.CommonPackage); err != nil {
+			return err
+		}
+		if !force && linkerFlags() == "" && commonUpToDate(project, dir, target) {
+			recordSkip(target)
+			manifestFor(project, arg).record("gopherjs", dir, target)
+		} else {
+			tasks = append(tasks, func() error {
+				start := time.Now()
+				logStepStart(arg, "gopherjs", dir)
+				err := compileCommon(project, arg, target)
+				logStepEnd(arg, "gopherjs", dir, start, err)
+				if err != nil {
+					return err
+				}
+				recordTiming("gopherjs", target, start)
+				manifestFor(project, arg).record("gopherjs", dir, target)
+				return nil
+			})
+		}
+	}
+	//walk each page, compiling to the static/en/web
+	optionsCache := loadOptionsCache(project, arg, lang)
+	for _, page := range pages {
+		target := jsTarget(project, arg, lang, page)
+		if !pageSelected(page) {
+			keepUnselected(project, arg, "gopherjs", page, target)
+			optionsCache.keep(target)
+			continue
+		}
+		options, err := readPageOptions(page)
+		if err != nil {
+			tasks = append(tasks, func() error { return err })
+			continue //a failure of the page, like a compile error
+		}
+		//the options are as much an input as the source, and hashing them
+		//notices a sidecar that is edited back or deleted, as times can't
+		optionsHash := ""
+		if s := options.String(); s != "" {
+			optionsHash, _ = hashInputs(nil, s)
+		}
+		if !force && linkerFlags() == "" && options.ldflags == "" && !optionsCache.changed(target, optionsHash) && jsUpToDate(project, page, target) {
+			optionsCache.set(target, optionsHash)
+			recordSkip(target)
+			manifestFor(project, arg).record("gopherjs", page, target)
+			continue //no point in running gopherjs
+		}
+		page := page
+		tasks = append(tasks, func() error {
+			if commonDir != "" {
+				noteIfImportsCommon(project, page, commonDir)
+			}
+			start := time.Now()
+			logStepStart(arg, "gopherjs", page)
+			err := compilePage(project, arg, page, target, options)
+			logStepEnd(arg, "gopherjs", page, start, err)
+			if err != nil {
+				return err
+			}
+			recordTiming("gopherjs", target, start)
+			manifestFor(project, arg).record("gopherjs", page, target)
+			optionsCache.set(target, optionsHash)
+			return nil
+		})
+	}
+
+	errs := forEachParallel(tasks)
+	//as for the page cache, the scripts that did build are worth remembering
+	if !dryRun {
+		if err := optionsCache.save(); err != nil {
+			logf(os.Stderr, "unable to write %s: %v\n", optionsCache.path, err)
+			return err
+		}
+	}
+	if err := reportTaskErrors("compile", errs, len(tasks)); err != nil {
+		return err
+	}
+	if fingerprint && !dryRun {
+		return fingerprintScripts(project, arg, lang)
+	}
+	return nil
+}
+
+func compilePage(project string, arg string, page string, target string, options pageOptions) error {
+	return compileScript(project, pageName(project, arg, page), compileSource(project, page), target, options)
+}
+
+// compileScript runs gopherjs on source in a scratch directory beside target
+// and renames the results into place only on success, so a failed or killed
+// compile never leaves partial javascript behind. The scratch output has
+// target's basename so the source map reference gopherjs embeds is right.
+func compileScript(project string, name string, source string, target string, options pageOptions) error {
+	if dryRun {
+		return launchGopherjs(buildContext, project, name, gopherjsBuildArgs(target, source, options)...)
+	}
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	scratch, err := ioutil.TempDir(dir, ".seven5-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	tmp := filepath.Join(scratch, filepath.Base(target))
+	if err := launchGopherjs(buildContext, project, name, gopherjsBuildArgs(tmp, source, options)...); err != nil {
+		return err
+	}
+	if _, err := os.Stat(tmp + ".map"); err == nil {
+		if sourceMapRoot != "" || trimPath {
+			err := editSourceMap(tmp+".map", func(sourceMap map[string]interface{}) {
+				if trimPath {
+					trimSourcePaths(project, sourceMap)
+				}
+				if sourceMapRoot != "" {
+					sourceMap["sourceRoot"] = sourceMapRoot
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(tmp+".map", target+".map"); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+// gopherjsBuildArgs returns the gopherjs command line that compiles page, a
+// file or an import path, to target: minified for production, or with
+// source maps under --dev.
+func gopherjsBuildArgs(target string, page string, options pageOptions) []string {
+	args := []string{"build"}
+	if dev {
+		args = append(args, "-s")
+	} else {
+		args = append(args, "-m")
+	}
+	if buildTags := options.buildTags(); len(buildTags) > 0 {
+		args = append(args, "-tags", strings.Join(buildTags, " "))
+	}
+	for _, option := range gopherjsOptions {
+		if options.isSet(option.name, *option.set) {
+			args = append(args, option.gopherjs)
+		}
+	}
+	linker := linkerFlags()
+	if options.ldflags != "" {
+		linker = strings.TrimSpace(linker + " " + strings.Join(strings.Fields(options.ldflags), " "))
+	}
+	if linker != "" {
+		args = append(args, "-ldflags", linker)
+	}
+	return append(args, "-o", target, page)
+}
+
+// linkerFlags returns the -ldflags for gopherjs build: those of --ldflags,
+// and with --build-id one setting main.BuildID, e.g. for
+//
+//	var BuildID string
+//
+// in a page's main package.
+func linkerFlags() string {
+	linker := strings.Fields(ldflags)
+	if buildID != "" {
+		linker = append(linker, "-X", "main.BuildID="+buildID)
+	}
+	return strings.Join(linker, " ")
+}
+
+// validateLdflags fails unless --ldflags is made of -X importpath.name=value
+// settings, the only linker flag with a meaning for javascript; the
+// linker's others are about native binaries.
+func validateLdflags() error {
+	if err := validateXSettings(ldflags); err != nil {
+		return fmt.Errorf("--ldflags: %v", err)
+	}
+	if strings.ContainsAny(buildID, " \t\n'\"") {
+		return fmt.Errorf("--build-id must not contain spaces or quotes, got %q", buildID)
+	}
+	return nil
+}
+
+// validateXSettings fails unless flags is made of -X importpath.name=value
+// settings.
+func validateXSettings(flags string) error {
+	fields := strings.Fields(flags)
+	for i := 0; i < len(fields); i++ {
+		setting := strings.TrimPrefix(fields[i], "-X=")
+		if fields[i] == "-X" && i+1 < len(fields) {
+			i++
+			setting = fields[i]
+		} else if setting == fields[i] {
+			return fmt.Errorf("only -X importpath.name=value is supported, got %q", fields[i])
+		}
+		if eq := strings.Index(setting, "="); eq <= 0 || !strings.Contains(setting[:eq], ".") {
+			return fmt.Errorf("-X wants importpath.name=value, got %q", setting)
+		}
+	}
+	return nil
+}
+
+// gopherjsOptions are the flags passed straight through to gopherjs build;
+// a new gopherjs option only needs a line here and its variable.
+var gopherjsOptions = []struct {
+	name     string
+	gopherjs string
+	set      *bool
+	usage    string
+}{
+	{"localmap", "--localmap", &localMap, "have gopherjs use local paths in source maps (needs --dev)"},
+	{"gopherjs-verbose", "-v", &gopherjsVerbose, "have gopherjs print the packages it compiles"},
+	{"gopherjs-quiet", "-q", &gopherjsQuiet, "have gopherjs suppress its non-fatal warnings"},
+}
+
+var (
+	localMap        = false
+	gopherjsVerbose = false
+	gopherjsQuiet   = false
+	sourceMapRoot   = ""
+	trimPath        = false
+
+	//ldflags and buildID go to gopherjs build as -ldflags; pages are
+	//always recompiled when there are any, since they change the output
+	//but not the sources
+	ldflags = ""
+	buildID = ""
+)
+
+// validateGopherjsOptions rejects combinations of the gopherjs options that
+// contradict each other. Only --dev builds produce source maps, so the
+// options about them need it.
+func validateGopherjsOptions() error {
+	if gopherjsVerbose && gopherjsQuiet {
+		return fmt.Errorf("--gopherjs-verbose and --gopherjs-quiet can't both be given")
+	}
+	if !dev && localMap {
+		return fmt.Errorf("--localmap needs --dev, production builds have no source maps")
+	}
+	if !dev && sourceMapRoot != "" {
+		return fmt.Errorf("--source-map-root needs --dev, production builds have no source maps")
+	}
+	if !dev && trimPath {
+		return fmt.Errorf("--trim-path needs --dev, production builds have no source maps")
+	}
+	return validateLdflags()
 }
 
-func pageGeneration(project string, arg string) error {
-	templatePath := constructTemplatesPath(project, arg)
+// editSourceMap rewrites the source map at path with edit, for what gopherjs
+// has no option for: --source-map-root sets the sourceRoot browsers prefix
+// to the source paths, e.g. to find them behind a CDN, and --trim-path
+// rewrites the paths themselves.
+func editSourceMap(path string, edit func(sourceMap map[string]interface{})) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sourceMap := map[string]interface{}{}
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		return fmt.Errorf("unable to read source map %s: %v", path, err)
+	}
+	edit(sourceMap)
+	if data, err = json.Marshal(sourceMap); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
 
-	jsonFiles := []string{}
-	htmlFiles := []string{}
-	err := filepath.Walk(templatePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error walking %s: %v\n", path, err)
-			return err
+// trimSourcePaths makes the absolute source paths in sourceMap, as gopherjs
+// writes for pages compiled by file name and under --localmap, relative to
+// the project, e.g. src/site/client/about.go. Those elsewhere in the GOPATH
+// or in GOROOT get gopath/ or goroot/ in place of the directory.
+func trimSourcePaths(project string, sourceMap map[string]interface{}) {
+	sources, ok := sourceMap["sources"].([]interface{})
+	if !ok {
+		return
+	}
+	roots := []struct{ dir, name string }{{project, ""}}
+	for _, dir := range filepath.SplitList(gopherjsPath(project)) {
+		if !strings.HasPrefix(dir, project+string(filepath.Separator)) && dir != project {
+			roots = append(roots, struct{ dir, name string }{dir, "gopath"})
 		}
-		//ignore the support dir
-		if info.IsDir() && info.Name() == "support" {
-			return filepath.SkipDir
+	}
+	roots = append(roots, struct{ dir, name string }{runtime.GOROOT(), "goroot"})
+	for i, source := range sources {
+		path, ok := source.(string)
+		if !ok || !filepath.IsAbs(filepath.FromSlash(path)) {
+			continue
 		}
-		//make sure that for each json there is an HTML
-		if strings.HasSuffix(info.Name(), ".json") {
-			parent := filepath.Dir(path)
-			root := strings.TrimSuffix(info.Name(), ".json")
-			_, err := os.Stat(filepath.Join(parent, root+".html"))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "unable to find corresponding html file for json file %s\n", path)
-				return fmt.Errorf("no html file for %s", path)
+		for _, root := range roots {
+			rel, err := filepath.Rel(root.dir, filepath.FromSlash(path))
+			if root.dir == "" || err != nil || strings.HasPrefix(rel, "..") {
+				continue
 			}
-			jsonFiles = append(jsonFiles, path)
-			htmlFiles = append(htmlFiles, filepath.Join(parent, root+".html"))
-		}
-		return nil
-	})
-
-	if verbose {
-		for i, json := range jsonFiles {
-			jsonShort := strings.TrimPrefix(json, constructPagesPath(project, arg))
-			html := htmlFiles[i]
-			htmlShort := strings.TrimPrefix(html, constructPagesPath(project, arg))
-			fmt.Printf("%d %s %s\n", i, jsonShort, htmlShort)
+			sources[i] = strings.TrimPrefix(root.name+"/"+filepath.ToSlash(rel), "/")
+			break
 		}
 	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to walk directory %s: %v", templatePath, err)
-		return err
-	}
+}
 
-	for i, jsonFile := range jsonFiles {
-		if !strings.HasPrefix(jsonFile, constructTemplatesPath(project, arg)) {
-			panic(fmt.Sprintf("unable to understand json path %s in template dir %s",
-				jsonFile, constructTemplatesPath(project, arg)))
-		}
-		html := strings.TrimPrefix(htmlFiles[i], constructTemplatesPath(project, arg))
-		json := strings.TrimPrefix(jsonFile, constructTemplatesPath(project, arg))
-		out := filepath.Join(constructStaticEnglishPath(project, arg), html)
-		support := filepath.Join(constructTemplatesPath(project, arg), "support")
-
-		criticalTime := time.Time{}
-		info, err := os.Stat(out)
-		if err == nil {
-			criticalTime = info.ModTime()
-		}
-		rebuild := false
-		rebuild = rebuild || fileAfter(filepath.Join(constructTemplatesPath(project, arg), html), criticalTime)
-		rebuild = rebuild || fileAfter(filepath.Join(constructTemplatesPath(project, arg), json), criticalTime)
-		rebuild = rebuild || anyDirectoryContentAfter(support, criticalTime)
-		if !rebuild {
-			continue //no point in running pagegen
-		}
-		fmt.Printf("gb seven5: rebuilding %s\n", out)
-		if err := launchPagegen("support",
-			constructTemplatesPath(project, arg),
-			html, json, out); err != nil {
-			return err
-		}
+// pageName identifies page in log output, e.g. "home/home" for
+// client/home/home.go.
+func pageName(project string, arg string, page string) string {
+	name := relativePath(constructClientPackagePath(project, arg), page)
+	return filepath.ToSlash(strings.TrimSuffix(name, ".go"))
+}
+
+// jsTarget returns the path of the javascript file compiled from page for
+// lang, as laid out by the js_layout, js_dir and js_extension config.
+func jsTarget(project string, arg string, lang string, page string) string {
+	suffix := relativePath(constructClientPackagePath(project, arg), page)
+	if config.JSLayout == "flat" {
+		suffix = filepath.Base(suffix)
 	}
-	return nil
+	suffix = strings.TrimSuffix(suffix, ".go") + config.JSExtension //output filename part
+	suffix = languageSuffix(suffix, lang)
+	return filepath.Join(constructWebPath(project, arg, lang), config.JSDir, suffix)
 }
 
-func fileAfter(path string, crit time.Time) bool {
-	info, err := os.Stat(path)
-	if err != nil {
-		return true
+// htmlTarget returns the path of the page generated from the html template
+// for lang.
+func htmlTarget(project string, arg string, lang string, html string) string {
+	suffix := relativePath(templateRootOf(project, arg, html), html)
+	return filepath.Join(constructWebPath(project, arg, lang), suffix)
+}
+
+// pageTarget returns the path of the page generated from the data file; it
+// is named after the data file rather than the template, since a template
+// may be shared by several data files. Under --pretty-urls about.json
+// becomes about/index.html, so it is served as /about/; relative links in
+// such a page's template resolve one directory deeper. Under the suffix
+// language layout the name carries the language, e.g. about.fr.html.
+func pageTarget(project string, arg string, lang string, data string) string {
+	root := strings.TrimSuffix(data, filepath.Ext(data))
+	if prettyURLs && filepath.Base(root) != "index" {
+		return htmlTarget(project, arg, lang, filepath.Join(root, languageSuffix("index.html", lang)))
 	}
-	return info.ModTime().After(crit)
+	return htmlTarget(project, arg, lang, languageSuffix(root+".html", lang))
 }
 
-func anyDirectoryContentAfter(path string, crit time.Time) bool {
-	result := false
-	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// jsUpToDate returns true if target is newer than the page's source file and
+// than the source of every package it (transitively) imports from the project
+// or its vendor directory.  Standard library imports are not considered.
+func jsUpToDate(project string, page string, target string) bool {
+	info, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	criticalTime := info.ModTime()
+	dirs := map[string]bool{}
+	for _, source := range pageSources(page) {
+		if fileAfter(source, criticalTime) {
+			return false
 		}
-		if !result && info.ModTime().After(crit) {
-			result = true
-
+		if err := collectImportDirs(project, source, dirs); err != nil {
+			return false
 		}
-		return nil
-	})
-	if err != nil {
-		return true
 	}
-	return result
+	for dir := range dirs {
+		if anyDirectoryContentAfter(dir, criticalTime) {
+			return false
+		}
+	}
+	return true
 }
 
-func gopherjsCompilation(project string, arg string) error {
-	//this the full path to the package from arg
-	dir := constructClientPackagePath(project, arg)
-
-	//find the gofiles in the package
-	gofiles, err := iterateDirs([]string{dir})
+// collectImportDirs adds to dirs the directory of each package imported by
+// the go file at path that can be found in the project or vendor source
+// trees, recursing into those packages.
+func collectImportDirs(project string, path string, dirs map[string]bool) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
 	if err != nil {
 		return err
 	}
-
-	//find the gofiles that have a main()
-	pages := []string{}
-	for _, gofile := range gofiles {
-		hasMain, err := hasMainFunc(gofile)
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
 		if err != nil {
 			return err
 		}
-		if hasMain {
-			pages = append(pages, gofile)
-		}
-	}
-
-	//walk each page, compiling to the static/en/web
-	for _, page := range pages {
-		if !strings.HasPrefix(page, constructClientPackagePath(project, arg)) {
-			panic(fmt.Sprintf("unable to understand page path %s in package %s",
-				page, constructClientPackagePath(project, arg)))
-		}
-		suffix := strings.TrimPrefix(page, constructClientPackagePath(project, arg))
-		suffix = strings.TrimSuffix(suffix, ".go") + ".js" //output filename part
-		target := filepath.Join(constructStaticEnglishPath(project, arg), suffix)
-		if err := launchGopherjs(project, "build", "-m", "-o", target, page); err != nil {
-			return err
+		for _, root := range []string{project, filepath.Join(project, "vendor")} {
+			dir := filepath.Join(constructSourcePath(root), filepath.FromSlash(importPath))
+			if dirs[dir] {
+				break
+			}
+			info, err := os.Stat(dir)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			dirs[dir] = true
+			gofiles, err := filepath.Glob(filepath.Join(dir, "*.go"))
+			if err != nil {
+				return err
+			}
+			for _, gofile := range gofiles {
+				if err := collectImportDirs(project, gofile, dirs); err != nil {
+					return err
+				}
+			}
+			break
 		}
 	}
-
 	return nil
 }
 
-func iterateDirs(dirs []string) ([]string, error) {
+// iterateDirs returns the go source files under dirs, leaving out tests and
+// whatever matches ignore.
+func iterateDirs(ignore *ignoreRules, dirs []string) ([]string, error) {
 	gofiles := []string{}
 	for _, dir := range dirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		err := walkTree(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error walking %s: %v\n", path, err)
+				logf(os.Stderr, "error walking %s: %v\n", path, err)
 				return err
 			}
+			if skip, err := ignore.skip(path, info); skip {
+				return err
+			}
+			//vendored code and test fixtures are never page entry points
+			if info.IsDir() && path != dir && (info.Name() == "vendor" || info.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			if strings.HasSuffix(info.Name(), "_test.go") {
+				return nil
+			}
 			if strings.HasSuffix(info.Name(), ".go") {
 				gofiles = append(gofiles, path)
 			}
@@ -213,84 +1639,453 @@ func iterateDirs(dirs []string) ([]string, error) {
 			return nil, err
 		}
 	}
+	//dirs may nest or come in any order; the build shouldn't depend on it
+	sort.Strings(gofiles)
 	return gofiles, nil
 }
 
 func hasMainFunc(path string) (bool, error) {
-	fset := token.NewFileSet() // positions are relative to fset
-
-	f, err := parser.ParseFile(fset, path, nil, 0)
+	//a main excluded by build constraints isn't a page
+	ctx := gopherjsContext()
+	match, err := ctx.MatchFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		logf(os.Stderr, "error reading build constraints of %s: %v\n", path, err)
+		return false, err
+	}
+	if !match {
+		return false, nil
+	}
+	isMain, err := declaresMain(path)
+	if list, ok := err.(scanner.ErrorList); ok && !verbose {
+		for _, e := range list {
+			logError("", e)
+		}
+		return false, err
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error parsing %s: %v", path, err)
+		logf(os.Stderr, "error parsing %s: %v\n", path, err)
 		return false, err
 	}
+	return isMain, nil
+}
+
+// gopherjsContext returns the build context gopherjs compiles client code
+// with, including any --tags.
+func gopherjsContext() build.Context {
+	ctx := build.Default
+	ctx.GOOS = "js"
+	ctx.GOARCH = "ecmascript"
+	ctx.CgoEnabled = false
+	ctx.BuildTags = strings.Fields(tags)
+	return ctx
+}
 
-	for _, decl := range f.Decls {
-		switch x := decl.(type) {
-		case *ast.FuncDecl:
-			if x.Name.String() == "main" {
-				return true, nil
+// gopherjsPath returns the GOPATH gopherjs runs with: the project and its
+// vendor directory, then, with inherit_gopath, the GOPATH gb seven5 was run
+// with, less those already there, e.g. a project inside it. Relative
+// entries are left out, as go ignores them.
+func gopherjsPath(projectDir string) string {
+	dirs := []string{projectDir, filepath.Join(projectDir, "vendor")}
+	if config.InheritGopath {
+		for _, dir := range filepath.SplitList(build.Default.GOPATH) {
+			if !filepath.IsAbs(dir) {
+				continue
+			}
+			if dir = filepath.Clean(dir); !containsString(dirs, dir) {
+				dirs = append(dirs, dir)
 			}
 		}
 	}
-	return false, nil
+	return strings.Join(dirs, string(os.PathListSeparator))
 }
 
-func launchGopherjs(projectDir string, args ...string) error {
-	cmd := exec.Command("gopherjs", args...)
-	vendor := projectDir + string(os.PathSeparator) + "vendor"
-	bothDirs := projectDir + string(os.PathListSeparator) + vendor
-	cmd.Env = append(os.Environ(), "GOPATH="+bothDirs)
-	out, err := cmd.CombinedOutput()
-	fmt.Printf("%s", string(out))
-	return err
+// launchGopherjs runs gopherjs with the project's GOPATH and the shared
+// cache, streaming its output prefixed with name.
+func launchGopherjs(ctx context.Context, projectDir string, name string, args ...string) error {
+	bothDirs := gopherjsPath(projectDir)
+	if dryRun {
+		logAt(os.Stdout, severityCommand, "gb seven5: would run GOPATH=%s %s\n", bothDirs, commandLine(toolPath("gopherjs"), args))
+		return nil
+	}
+	env := gopherjsEnv(projectDir)
+	warm, done := awaitWarmCache(projectDir)
+	defer done()
+	if verbose {
+		start := time.Now()
+		defer func() {
+			cache := "cold"
+			if warm {
+				cache = "warm"
+			}
+			logf(os.Stdout, "gb seven5: %s: compiled with a %s gopherjs cache in %v\n", name, cache, roundDuration(time.Since(start)))
+		}()
+	}
+	for attempt := 1; ; attempt++ {
+		var output bytes.Buffer
+		stdout := newLineWriter(os.Stdout, name)
+		stderr := newLineWriter(os.Stderr, name)
+		err := runWithTimeout(ctx, toolPath("gopherjs"), args, env, nil,
+			io.MultiWriter(stdout, &output), io.MultiWriter(stderr, &output))
+		stdout.Flush()
+		stderr.Flush()
+		if err == nil && strict {
+			return gopherjsWarnings(name, output.Bytes())
+		}
+		if err == nil || attempt > retries || !transientFailure(ctx, err, output.Bytes()) {
+			return err
+		}
+		backoff := time.Duration(attempt) * retryBackoff
+		logf(os.Stderr, "gb seven5: %s: gopherjs failed (%v), retrying in %v (%d of %d)\n",
+			name, err, backoff, attempt, retries)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// gopherjsWarning matches a line of gopherjs output that warns of
+// something, such as reflection it can't support.
+var gopherjsWarning = regexp.MustCompile(`(?mi)^.*\bwarning\b.*$`)
+
+// gopherjsWarnings fails a build, under --strict, whose output has any
+// warnings in it, quoting them.
+func gopherjsWarnings(name string, output []byte) error {
+	lines := gopherjsWarning.FindAll(output, -1)
+	if len(lines) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: gopherjs printed %d warning(s) (--strict):\n%s", name, len(lines), bytes.Join(lines, []byte("\n")))
+}
+
+// goCompileError matches the file:line: position that starts a compiler
+// error, which no amount of retrying will fix.
+var goCompileError = regexp.MustCompile(`(?m)\.go:[0-9]+(:[0-9]+)?: `)
+
+// transientFailure guesses whether a failed gopherjs run is worth
+// retrying: it exited non-zero having reported no compile errors, as when
+// a networked disk briefly fails a lock or read.
+func transientFailure(ctx context.Context, err error, output []byte) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return false
+	}
+	return !goCompileError.Match(output)
+}
+
+// pagegenManagedFlags are the pagegen flags launchPagegen sets itself.
+var pagegenManagedFlags = []string{"support", "dir", "start", "json"}
+
+// validatePagegenArgs rejects extra pagegen arguments that would set one of
+// the flags gb seven5 manages, in any of the spellings pagegen accepts.
+func validatePagegenArgs(args []string) error {
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue //not a flag, e.g. the value of the one before
+		}
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		if containsString(pagegenManagedFlags, name) {
+			return fmt.Errorf("%s is set by gb seven5 and can't be given again", arg)
+		}
+	}
+	return nil
 }
 
-func launchPagegen(supportPath, templatesPath, htmlInFile, jsonFile, htmlOutFile string) error {
-	cmd := exec.Command("pagegen", "--support", supportPath, "--dir", templatesPath, "--start",
-		htmlInFile, "--json", jsonFile)
-	out, err := cmd.Output()
+func launchPagegen(ctx context.Context, supportPath, templatesPath, htmlInFile, jsonFile, htmlOutFile string) error {
+	args := []string{"--support", supportPath, "--dir", templatesPath, "--start",
+		htmlInFile, "--json", jsonFile}
+	args = append(args, config.PagegenArgs...)
+	args = append(args, pagegenArgs...)
+	if dryRun {
+		logAt(os.Stdout, severityCommand, "gb seven5: would run %s > %s\n", commandLine(toolPath("pagegen"), args), htmlOutFile)
+		return nil
+	}
+	if verbose {
+		logf(os.Stdout, "gb seven5: running %s > %s\n", commandLine(toolPath("pagegen"), args), htmlOutFile)
+	}
+	var out bytes.Buffer
+	stderr := newLineWriter(os.Stderr, strings.TrimPrefix(htmlInFile, string(filepath.Separator)))
+	err := runWithTimeout(ctx, toolPath("pagegen"), args, nil, nil, &out, stderr)
+	stderr.Flush()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err() //don't write output once interrupted
+	}
 	if err != nil {
-		if execError, ok := err.(*exec.ExitError); ok {
-			fmt.Fprintf(os.Stderr, "%s\n", string(execError.Stderr))
-			return execError
+		switch err.(type) {
+		case *exec.ExitError, *timeoutError:
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
 		}
-		fmt.Fprintf(os.Stderr, "Unable to start pagegen process: %v\n", err)
+		logf(os.Stderr, "Unable to start pagegen process: %v\n", err)
 		return err
 	}
-	file, err := os.Create(htmlOutFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to create output file %s: %v\n", htmlOutFile, err)
+	if err := os.MkdirAll(filepath.Dir(htmlOutFile), 0755); err != nil {
+		logf(os.Stderr, "unable to create output directory for %s: %v\n", htmlOutFile, err)
 		return err
 	}
-	buff := bytes.NewBuffer(out)
-	_, err = io.Copy(file, buff)
-	return err
+	page := out.Bytes()
+	if validateHTML {
+		if err := checkHTML(page); err != nil {
+			err = fmt.Errorf("%s: malformed html: %v", htmlOutFile, err)
+			logf(os.Stderr, "%v\n", err)
+			return err
+		}
+	}
+	if minify {
+		page = minifyHTML(page)
+	}
+	if err := writeFileAtomic(htmlOutFile, page); err != nil {
+		logf(os.Stderr, "unable to write output file %s: %v\n", htmlOutFile, err)
+		return err
+	}
+	return nil
 }
 
 func help() {
 	fmt.Printf("gb seven5 requires a package name to build client software from\n")
+	fmt.Printf("usage: gb seven5 [flags] [clean] package...\n")
+	fmt.Printf("       gb seven5 check package...\n")
+	fmt.Printf("       gb seven5 [--json] list package...\n")
+	fmt.Printf("       gb seven5 [--addr :8080] serve package\n")
+	fmt.Printf("       gb seven5 test package... [-- gopherjs test flags, e.g. -run TestCart -v]\n")
+	fmt.Printf("       gb seven5 version\n")
+	fmt.Printf("--tags applies to both --dev and production builds; it also decides which\n")
+	fmt.Printf("files with a main func are treated as pages.\n")
+	fmt.Printf("common_package in %s compiles a package to its own common.js, but a page\n", configName)
+	fmt.Printf("that imports it still gets its own copy; pages share it through javascript globals.\n")
+	flags.PrintDefaults()
 }
 
 //
 // SUPPORT FUNCS
 //
 
+// findProjectDir returns the project root for a run outside of gb: the
+// nearest directory, from the current one up, that has a seven5.json or a
+// src directory, as gb itself would find.
+func findProjectDir() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, configName)); err == nil {
+			return dir, nil
+		}
+		if info, err := os.Stat(constructSourcePath(dir)); err == nil && info.IsDir() {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return "", fmt.Errorf("GB_PROJECT_DIR is not set and no directory above %s has a src directory or %s", cwd, configName)
+}
+
+// canonicalProjectDir returns project absolute and with its symlinks
+// evaluated, so that every path built from it, and every path found by
+// walking below it, shares one spelling of the root.
+func canonicalProjectDir(project string) (string, error) {
+	abs, err := filepath.Abs(project)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// relativePath returns path relative to base, the directory it was found
+// in; unlike trimming the prefix it doesn't depend on how either spells
+// its separators.
+func relativePath(base string, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return path //only if one is absolute and the other not
+	}
+	return rel
+}
+
+// writeFileAtomic writes data to a temporary file in path's directory and
+// renames it over path, so readers see either the old or the new contents
+// and never a truncated file. The temporary file is removed on failure.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	//TempFile creates the file 0600, generated pages should be readable
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// targetSet maps each output path to the source it is built from, so that
+// two sources that would write the same file are caught before either is
+// built. Paths are compared ignoring case because the output is often
+// served from, or copied to, a case-insensitive filesystem.
+type targetSet map[string]string
+
+func (t targetSet) claim(target string, source string) error {
+	key := strings.ToLower(target)
+	if other, ok := t[key]; ok && other != source {
+		err := fmt.Errorf("%s and %s would both be built to %s", other, source, target)
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	t[key] = source
+	return nil
+}
+
+// commandLine renders a command for display, quoting arguments that
+// contain spaces or shell metacharacters.
+func commandLine(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$&|;<>*?") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// forEachParallel runs the tasks and returns the errors in task order, so
+// reporting doesn't depend on scheduling. Each task takes one of the
+// jobSlots while it runs, so however many packages are being built at once
+// no more than --jobs tasks run together.
+func forEachParallel(tasks []func() error) []error {
+	results := make([]error, len(tasks))
+	sem := jobSlots
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, task func() error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if buildContext.Err() != nil {
+				results[i] = errInterrupted
+				return
+			}
+			results[i] = task()
+			failed(results[i])
+			countFailure(results[i])
+		}(i, task)
+	}
+	wg.Wait()
+	errs := []error{}
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// failed notes err, the result of a page or package build. Under
+// --fail-fast the first real failure cancels the rest of the build, killing
+// the gopherjs and pagegen runs still going.
+func failed(err error) {
+	if !failFast || err == nil || buildContext.Err() != nil {
+		return
+	}
+	failureOnce.Do(func() {
+		firstFailure = err
+		cancelBuild()
+	})
+}
+
+// countFailure notes err, the result of a page build, against --max-errors,
+// cancelling the rest of the build once there are that many.
+func countFailure(err error) {
+	if maxErrors == 0 || err == nil || buildContext.Err() != nil {
+		return
+	}
+	cappedLock.Lock()
+	defer cappedLock.Unlock()
+	cappedErrors = append(cappedErrors, err)
+	if len(cappedErrors) == maxErrors {
+		cancelBuild()
+	}
+}
+
+// errorCapReached reports whether --max-errors stopped the build.
+func errorCapReached() bool {
+	cappedLock.Lock()
+	defer cappedLock.Unlock()
+	return maxErrors > 0 && len(cappedErrors) >= maxErrors
+}
+
+func reportTaskErrors(verb string, errs []error, total int) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	//errors from killed processes are just noise
+	if buildContext.Err() != nil {
+		return errInterrupted
+	}
+	for _, err := range errs {
+		logError("", err)
+	}
+	return fmt.Errorf("%d of %d pages failed to %s", len(errs), total, verb)
+}
+
+// constructSourcePath returns the directory the project's packages are in.
+func constructSourcePath(project string) string {
+	return filepath.Join(project, sourceDir)
+}
+
+// constructPackagePath returns arg's directory, which the Layout is
+// relative to.
+func constructPackagePath(project string, arg string) string {
+	return filepath.Join(constructSourcePath(project), arg)
+}
+
 func constructClientPackagePath(project string, arg string) string {
-	return filepath.Join(project, "src", arg, "client")
+	return filepath.Join(constructPackagePath(project, arg), config.Layout.ClientDir)
 }
 func constructPagesPath(project string, arg string) string {
-	return filepath.Join(project, "src", arg, "pages")
+	return filepath.Join(constructPackagePath(project, arg), config.Layout.PagesDir)
 }
 func constructTemplatesPath(project string, arg string) string {
-	return filepath.Join(project, "src", arg, "pages")
+	return constructPagesPath(project, arg)
 }
-func constructSupportPath(project string, arg string) string {
-	return filepath.Join(project, "src", arg, "pages", "support")
+
+// constructStaticPath returns arg's output root: its static directory, or
+// <out>/<arg> under --out.
+func constructStaticPath(project string, arg string) string {
+	if outDir != "" {
+		return filepath.Join(outDir, filepath.FromSlash(arg))
+	}
+	return filepath.Join(constructPackagePath(project, arg), config.Layout.StaticDir)
 }
 
-func constructStaticEnglishPath(project string, arg string) string {
-	return filepath.Join(project, "src", arg, "static", "en", "web")
+// constructWebPath returns arg's web directory for lang, e.g.
+// static/fr/web.
+func constructWebPath(project string, arg string, lang string) string {
+	return filepath.Join(constructStaticPath(project, arg), webDirFor(lang))
 }
 
 func validateClientPackage(projectDir string, arg string) error {
@@ -304,39 +2099,118 @@ func validatePagesDir(projectDir string, arg string) error {
 	return err
 }
 
-func validateStaticEnglishDir(projectDir string, arg string) error {
-	path := constructStaticEnglishPath(projectDir, arg)
+func validateStaticEnglishDir(projectDir string, arg string, lang string) error {
+	path := constructWebPath(projectDir, arg, lang)
 	_, err := os.Stat(path)
 	return err
 }
 
 func validateExecutablesInPath(projectDir string) error {
-	cmd := exec.Command("gopherjs")
-	cmd.Env = append(os.Environ(), "GOPATH="+projectDir)
-	if err := cmd.Run(); err != nil {
+	for _, name := range []string{"gopherjs", "pagegen"} {
+		if err := validateExecutable(projectDir, name); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil //nothing runs, but a dry run should still notice a missing tool
+	}
+	if err := validateToolVersion(projectDir, "gopherjs", minGopherjsVersion, "version"); err != nil {
 		return err
 	}
-	cmd = exec.Command("pagegen")
-	return cmd.Run()
+	return validateToolVersion(projectDir, "pagegen", minPagegenVersion, "--version")
+}
+
+// validateExecutable checks that the named tool is an executable file
+// that runs, telling a missing tool apart from one that is there but
+// broken. Both tools are run the way builds run gopherjs, in the
+// environment of gopherjsEnv.
+func validateExecutable(projectDir string, name string) error {
+	path, err := exec.LookPath(toolPath(name))
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%s is not installed or not on PATH (or set %s in %s, or GB_SEVEN5_%s)",
+			toolPath(name), name, configName, strings.ToUpper(name))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s does not exist (from %s or GB_SEVEN5_%s)", toolPath(name), configName, strings.ToUpper(name))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to use %s: %v", toolPath(name), err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to use %s: %v", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("unable to use %s: not a regular file", path)
+	}
+	if dryRun {
+		return nil
+	}
+	env := gopherjsEnv(projectDir)
+	if err := runner.Run(buildContext, path, nil, env, nil, ioutil.Discard, ioutil.Discard); err != nil {
+		return fmt.Errorf("unable to run %s: %v", path, err)
+	}
+	return nil
+}
+
+// validatePackageSpec rejects package specs that would resolve to a path
+// outside of the project's src directory.
+func validatePackageSpec(project string, arg string) error {
+	for _, part := range strings.Split(filepath.ToSlash(arg), "/") {
+		if part == ".." {
+			return fmt.Errorf("package %s must not contain '..'", arg)
+		}
+	}
+	src := constructSourcePath(project)
+	rel, err := filepath.Rel(src, filepath.Join(src, arg))
+	if err != nil || rel == "." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("package %s is not inside %s", arg, src)
+	}
+	return nil
 }
 
 func validateProjectStructure(project string, arg string) error {
+	//the package has to be somewhere under src in the project
+	if err := validatePackageSpec(project, arg); err != nil {
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
 	//validate that the packages provided have a client subpackage
-	//and the static/en/web directory, as expected
+	//and a static/<lang>/web directory, as expected (or as configured)
 	if err := validateClientPackage(project, arg); err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to find client package in %s\n",
-			constructClientPackagePath(project, arg))
+		logf(os.Stderr, "Unable to find client package in %s (client_dir in %s)\n",
+			constructClientPackagePath(project, arg), configName)
+		return err
+	}
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return err
+	}
+	//an --out tree is created as it is written
+	err = forEachLanguage(langs, func(lang string) error {
+		err := validateStaticEnglishDir(project, arg, lang)
+		if err != nil && outDir == "" {
+			logf(os.Stderr, "Unable to find %s directory, expected it to be %s (static_dir, web_dir in %s)\n",
+				filepath.Join(config.Layout.StaticDir, webDirFor(lang)), constructWebPath(project, arg, lang), configName)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	//the pages dir is optional, a package may have no html pages
+	if err := validatePagesDir(project, arg); err != nil && !os.IsNotExist(err) {
+		logf(os.Stderr, "Unable to read pages directory %s (pages_dir in %s)\n",
+			constructPagesPath(project, arg), configName)
 		return err
 	}
-	if err := validateStaticEnglishDir(project, arg); err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to find static/en/web directory, expected it to be %s\n",
-			constructStaticEnglishPath(project, arg))
+	if err := validateTemplateRoots(project, arg); err != nil {
+		logf(os.Stderr, "bad template directory (template_dirs in %s): %v\n", configName, err)
 		return err
 	}
-	//make sure it has the pages dir
-	if err := validatePagesDir(project, arg); err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to find pages directory, expected it to be %s\n",
-			constructPagesPath(project, arg))
+	if _, err := readIgnoreRules(project, arg); err != nil {
+		logf(os.Stderr, "Unable to read %s: %v\n", constructIgnorePath(project, arg), err)
 		return err
 	}
 	return nil
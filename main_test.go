@@ -0,0 +1,664 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestProject returns a project holding a package for each of pkgs,
+// laid out as the defaults expect: a client page, an en web directory and
+// one templated page.
+func newTestProject(t *testing.T, pkgs ...string) string {
+	t.Helper()
+	project := t.TempDir()
+	for _, pkg := range pkgs {
+		writeFiles(t, filepath.Join(project, "src", pkg), map[string]string{
+			"client/about.go":  "package main\n\nfunc main() {}\n",
+			"static/en/web/.k": "",
+			"pages/index.html": "<html><body>{{.Title}}</body></html>\n",
+			"pages/index.json": `{"Title": "home"}` + "\n",
+		})
+	}
+	return project
+}
+
+// withTools points the gopherjs and pagegen paths at stand-in executables,
+// which the fake runner never really runs, so run's check that the tools
+// exist passes.
+func withTools(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"gopherjs", "pagegen"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("GB_SEVEN5_"+strings.ToUpper(name), path)
+	}
+}
+
+func TestRunMissingClientDir(t *testing.T) {
+	useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	if err := os.RemoveAll(filepath.Join(project, "src", "site", "client")); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(project, []string{"site"}); err == nil {
+		t.Fatal("built a package without a client directory")
+	}
+}
+
+func TestRunBuildsPackagesInOrder(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "one", "two", "three")
+	if err := run(project, []string{"--jobs", "1", "one", "two", "three"}); err != nil {
+		t.Fatal(err)
+	}
+	order := []string{}
+	for _, call := range fake.commands("gopherjs") {
+		if len(call.args) > 0 && call.args[0] == "build" {
+			page := call.args[len(call.args)-1]
+			order = append(order, filepath.Base(filepath.Dir(filepath.Dir(page))))
+		}
+	}
+	if strings.Join(order, " ") != "one two three" {
+		t.Errorf("compiled in order %v, want one two three", order)
+	}
+	for _, pkg := range []string{"one", "two", "three"} {
+		for _, out := range []string{"about.js", "index.html"} {
+			if _, err := os.Stat(filepath.Join(project, "src", pkg, "static", "en", "web", out)); err != nil {
+				t.Errorf("%s: %v", pkg, err)
+			}
+		}
+	}
+}
+
+func TestValidatePackageSpec(t *testing.T) {
+	project := t.TempDir()
+	tests := []struct {
+		arg string
+		ok  bool
+	}{
+		{"site", true},
+		{"github.com/user/site", true},
+		{"a/b/../c", false},
+		{"../outside", false},
+		{"..", false},
+		{".", false},
+		{"site/..", false},
+	}
+	for _, test := range tests {
+		err := validatePackageSpec(project, test.arg)
+		if (err == nil) != test.ok {
+			t.Errorf("validatePackageSpec(%q) = %v, want ok %v", test.arg, err, test.ok)
+		}
+	}
+}
+
+func TestHasMainFunc(t *testing.T) {
+	resetOptions(t)
+	tests := []struct {
+		name   string
+		source string
+		want   bool
+	}{
+		{"page", "package main\n\nfunc main() {}\n", true},
+		{"library", "package lib\n\nfunc main() {}\n", false},
+		{"no-main", "package main\n\nfunc run() {}\n", false},
+		{"method", "package main\n\ntype t struct{}\n\nfunc (t) main() {}\n", false},
+		{"excluded", "// +build ignore\n\npackage main\n\nfunc main() {}\n", false},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name+".go")
+		writeFiles(t, dir, map[string]string{test.name + ".go": test.source})
+		got, err := hasMainFunc(path)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: hasMainFunc = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIterateDirs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"about.go":               "package main\n",
+		"about_test.go":          "package main\n\nfunc main() {}\n",
+		"nested/contact.go":      "package main\n",
+		"vendor/lib/lib.go":      "package lib\n",
+		"testdata/fixture.go":    "package main\n",
+		"nested/testdata/old.go": "package main\n",
+		"notes.txt":              "",
+	})
+	got, err := iterateDirs(nil, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "about.go"), filepath.Join(dir, "nested", "contact.go")}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("iterateDirs = %v, want %v", got, want)
+	}
+}
+
+func TestRunCustomSupportDir(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	writeFiles(t, project, map[string]string{
+		configName:                                `{"support_dir": "includes"}`,
+		"src/site/pages/includes/header.html":     "<h1>{{.Title}}</h1>\n",
+		"src/site/pages/includes/not-a-page.json": "{}\n",
+	})
+	if err := run(project, []string{"site"}); err != nil {
+		t.Fatal(err)
+	}
+	pages := []string{}
+	for _, call := range fake.commands("pagegen") {
+		for i := range call.args {
+			if call.args[i] == "--support" {
+				if got := call.args[i+1]; got != "includes" {
+					t.Errorf("pagegen --support %s, want includes", got)
+				}
+				pages = append(pages, call.args[len(call.args)-1])
+			}
+		}
+	}
+	if len(pages) != 1 {
+		t.Errorf("ran pagegen for %v, want just index.json", pages)
+	}
+}
+
+func TestRunWithoutTemplates(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(pages string) error
+	}{
+		{"missing", os.RemoveAll},
+		{"empty", func(pages string) error {
+			if err := os.RemoveAll(pages); err != nil {
+				return err
+			}
+			return os.Mkdir(pages, 0755)
+		}},
+		{"html only", func(pages string) error {
+			return os.Remove(filepath.Join(pages, "index.json"))
+		}},
+	}
+	for _, test := range tests {
+		fake := useFakeRunner(t)
+		withTools(t)
+		project := newTestProject(t, "site")
+		if err := test.setup(filepath.Join(project, "src", "site", "pages")); err != nil {
+			t.Fatal(err)
+		}
+		if err := run(project, []string{"site"}); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		for _, call := range fake.commands("pagegen") {
+			if len(call.args) > 0 && call.args[0] == "--support" {
+				t.Errorf("%s: ran pagegen %v", test.name, call.args)
+			}
+		}
+	}
+}
+
+func TestRunTargetCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		compiles bool
+		files    map[string]string
+	}{
+		{"flat scripts", false, map[string]string{
+			configName:                   `{"js_layout": "flat"}`,
+			"src/site/client/a/index.go": "package main\n\nfunc main() {}\n",
+			"src/site/client/b/index.go": "package main\n\nfunc main() {}\n",
+		}},
+		{"pages", true, map[string]string{
+			"src/site/pages/index.yaml": "Title: home\n",
+		}},
+	}
+	for _, test := range tests {
+		fake := useFakeRunner(t)
+		withTools(t)
+		project := newTestProject(t, "site")
+		writeFiles(t, project, test.files)
+		err := run(project, []string{"site"})
+		if err == nil {
+			t.Errorf("%s: no error for a shared target", test.name)
+		}
+		for _, call := range fake.commands("gopherjs") {
+			if !test.compiles && len(call.args) > 0 && call.args[0] == "build" {
+				t.Errorf("%s: compiled %v despite the collision", test.name, call.args)
+			}
+		}
+	}
+}
+
+func TestTargetSetClaim(t *testing.T) {
+	targets := targetSet{}
+	tests := []struct {
+		target, source string
+		ok             bool
+	}{
+		{"/w/index.js", "/c/a/index.go", true},
+		{"/w/index.js", "/c/a/index.go", true},
+		{"/w/about.js", "/c/about.go", true},
+		{"/w/index.js", "/c/b/index.go", false},
+		{"/w/About.js", "/c/About.go", false},
+	}
+	for _, test := range tests {
+		err := targets.claim(test.target, test.source)
+		if (err == nil) != test.ok {
+			t.Errorf("claim(%s, %s) = %v, want ok %v", test.target, test.source, err, test.ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), test.source) {
+			t.Errorf("claim error %q doesn't name %s", err, test.source)
+		}
+	}
+}
+
+// listFiles returns the files under dir, relative to it.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, relativePath(dir, path))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRunOutLeavesSourceAlone(t *testing.T) {
+	useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	src := filepath.Join(project, "src")
+	if err := os.RemoveAll(filepath.Join(src, "site", "static")); err != nil {
+		t.Fatal(err)
+	}
+	before := listFiles(t, src)
+	dist := filepath.Join(project, "dist")
+	if err := run(project, []string{"--out", dist, "site"}); err != nil {
+		t.Fatal(err)
+	}
+	if after := listFiles(t, src); strings.Join(after, " ") != strings.Join(before, " ") {
+		t.Errorf("src went from %v to %v", before, after)
+	}
+	for _, out := range []string{"about.js", "index.html"} {
+		if _, err := os.Stat(filepath.Join(dist, "site", "en", "web", out)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRunScratchFilesBesideOutput(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	writeFiles(t, project, map[string]string{
+		configName:                            `{"template_dirs": ["pages", "design"]}`,
+		"src/site/pages/support/header.html":  "<h1></h1>\n",
+		"src/site/design/support/footer.html": "<p></p>\n",
+		"src/site/pages/blog/post.yaml":       "Title: post\n",
+		"src/site/pages/blog/post.html":       "<p>{{.Title}}</p>\n",
+		"src/site/pages/about.html":           "---\nTitle: about\n---\n<p>{{.Title}}</p>\n",
+	})
+	if err := run(project, []string{"site"}); err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(project, "src", "site")
+	web := filepath.Join(pkg, "static", "en", "web")
+	runs := 0
+	for _, call := range fake.commands("pagegen") {
+		if len(call.args) < 8 || call.args[0] != "--support" {
+			continue
+		}
+		runs++
+		dir := call.args[3]
+		support := filepath.Join(dir, call.args[1])
+		start := filepath.Join(dir, call.args[5])
+		json := filepath.Join(dir, call.args[7])
+		for _, path := range []string{support, start, json} {
+			if !strings.HasPrefix(path, pkg+string(filepath.Separator)) {
+				t.Errorf("pagegen %v reads %s, outside the package", call.args, path)
+			}
+		}
+		if !strings.HasPrefix(support, web) {
+			t.Errorf("merged support %s isn't under the web directory", support)
+		}
+		if strings.HasSuffix(start, "about.html") && !strings.HasPrefix(start, web) {
+			t.Errorf("front matter template %s isn't beside its output", start)
+		}
+		if strings.HasSuffix(json, "post.json") && !strings.HasPrefix(json, filepath.Join(web, "blog")) {
+			t.Errorf("yaml data %s isn't beside its output", json)
+		}
+	}
+	if runs != 3 {
+		t.Errorf("ran pagegen %d times, want 3", runs)
+	}
+	for _, file := range listFiles(t, web) {
+		if strings.Contains(file, ".seven5-") {
+			t.Errorf("left scratch file %s", file)
+		}
+	}
+}
+
+func TestValidateExecutable(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"plain": "", "tool": "#!/bin/sh\n", "sub/.k": ""})
+	if err := os.Chmod(filepath.Join(dir, "tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		path  string
+		fails bool //whether running it fails
+		want  string
+	}{
+		{"not on PATH", "seven5-no-such-tool", false, "is not installed or not on PATH"},
+		{"missing", filepath.Join(dir, "missing"), false, "does not exist"},
+		{"directory", filepath.Join(dir, "sub"), false, "unable to use"},
+		{"not executable", filepath.Join(dir, "plain"), false, "unable to use"},
+		{"broken", filepath.Join(dir, "tool"), true, "unable to run"},
+		{"working", filepath.Join(dir, "tool"), false, ""},
+	}
+	for _, test := range tests {
+		fake := useFakeRunner(t)
+		if test.fails {
+			fake.run = func(call fakeCall, stdout io.Writer, stderr io.Writer) error {
+				return errors.New("exec format error")
+			}
+		}
+		t.Setenv("GB_SEVEN5_GOPHERJS", test.path)
+		err := validateExecutable(t.TempDir(), "gopherjs")
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s: validateExecutable = %v, want %q", test.name, err, test.want)
+		}
+		if test.want == "" || test.fails {
+			calls := fake.commands("tool")
+			if len(calls) != 1 || len(calls[0].args) != 0 {
+				t.Errorf("%s: ran %v, want the tool run with no arguments", test.name, calls)
+			} else if !strings.Contains(strings.Join(calls[0].env, " "), "GOPATH=") {
+				t.Errorf("%s: ran the tool without gopherjsEnv", test.name)
+			}
+		}
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		base, path, want string
+	}{
+		{"/p/src/site/client", "/p/src/site/client/about.go", "about.go"},
+		{"/p/src/site/client/", "/p/src/site/client/blog/post.go", filepath.Join("blog", "post.go")},
+		{"/p/src/site/client", "/p/src/site/client//blog/./post.go", filepath.Join("blog", "post.go")},
+		{"/p/src/site/pages", "/p/src/site/pages", "."},
+		{"/p/src/site/pages", "/p/src/site/static/en/web/x.json", filepath.Join("..", "static", "en", "web", "x.json")},
+		{"/p/src/site/client", "client/about.go", "client/about.go"},
+		{filepath.FromSlash("/p/src/site/client"), filepath.FromSlash("/p/src/site/client/blog/post.go"), filepath.Join("blog", "post.go")},
+		{filepath.FromSlash("/p/src/site/client/"), filepath.FromSlash("/p/src/site/client/blog/post.go"), filepath.Join("blog", "post.go")},
+	}
+	//a windows path may spell its separators either way, even in one path
+	if filepath.Separator == '\\' {
+		tests = append(tests, []struct {
+			base, path, want string
+		}{
+			{`C:\p\src\site\client`, `C:\p\src\site\client\blog\post.go`, `blog\post.go`},
+			{`C:\p\src\site\client\`, `C:\p\src\site\client\blog\post.go`, `blog\post.go`},
+			{`C:/p/src/site/client`, `C:\p\src\site\client\blog\post.go`, `blog\post.go`},
+			{`C:\p\src\site\client`, `C:/p/src/site/client/blog/post.go`, `blog\post.go`},
+			{`C:\p\src\site\client`, `C:\p\src/site\client/blog\post.go`, `blog\post.go`},
+			{`C:\p\src\site\pages`, `C:\p\src\site\static\en\web\x.json`, `..\static\en\web\x.json`},
+		}...)
+	}
+	for _, test := range tests {
+		if got := relativePath(test.base, test.path); got != test.want {
+			t.Errorf("relativePath(%q, %q) = %q, want %q", test.base, test.path, got, test.want)
+		}
+	}
+}
+
+func TestTargets(t *testing.T) {
+	project := filepath.FromSlash("/p")
+	client := filepath.Join(project, "src", "site", "client")
+	pages := filepath.Join(project, "src", "site", "pages")
+	web := filepath.Join(project, "src", "site", "static", "en", "web")
+	tests := []struct {
+		name   string
+		config string
+		target func() string
+		want   string
+	}{
+		{"script", "{}", func() string { return jsTarget(project, "site", "en", filepath.Join(client, "about.go")) },
+			filepath.Join(web, "about.js")},
+		{"nested script", "{}", func() string { return jsTarget(project, "site", "en", filepath.Join(client, "blog", "post.go")) },
+			filepath.Join(web, "blog", "post.js")},
+		{"flat script", `{"js_layout": "flat", "js_dir": "js"}`,
+			func() string { return jsTarget(project, "site", "en", filepath.Join(client, "blog", "post.go")) },
+			filepath.Join(web, "js", "post.js")},
+		{"page", "{}", func() string { return pageTarget(project, "site", "en", filepath.Join(pages, "blog", "post.yaml")) },
+			filepath.Join(web, "blog", "post.html")},
+		{"trailing separator", `{"client_dir": "client/"}`,
+			func() string { return jsTarget(project, "site", "en", filepath.Join(client, "about.go")) },
+			filepath.Join(web, "about.js")},
+		{"other language", "{}", func() string { return pageTarget(project, "site", "fr", filepath.Join(pages, "about.json")) },
+			filepath.Join(project, "src", "site", "static", "fr", "web", "about.html")},
+		{"suffix layout", `{"language_layout": "suffix", "languages": ["fr"]}`,
+			func() string { return jsTarget(project, "site", "fr", filepath.Join(client, "about.go")) },
+			filepath.Join(web, "about.fr.js")},
+	}
+	for _, test := range tests {
+		resetOptions(t)
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{configName: test.config})
+		var err error
+		if config, err = loadConfig(dir); err != nil {
+			t.Fatal(err)
+		}
+		if got := test.target(); got != test.want {
+			t.Errorf("%s: target %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRunValidateHTMLRegenerates(t *testing.T) {
+	withTools(t)
+	project := newTestProject(t, "site")
+	pages := 0
+	for _, args := range [][]string{{"site"}, {"site"}, {"--validate-html", "site"}} {
+		fake := useFakeRunner(t)
+		if err := run(project, args); err != nil {
+			t.Fatal(err)
+		}
+		for _, call := range fake.commands("pagegen") {
+			if len(call.args) > 0 && call.args[0] == "--support" {
+				pages++
+			}
+		}
+	}
+	//the second build finds the page up to date, the third has to check it
+	if pages != 2 {
+		t.Errorf("ran pagegen %d times, want 2", pages)
+	}
+}
+
+func TestCanonicalProjectDir(t *testing.T) {
+	//the temp directory may itself be behind a link, e.g. /tmp on macOS
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(base, "project")
+	writeFiles(t, project, map[string]string{"src/.k": ""})
+	if err := os.Symlink(project, filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(base)
+	tests := []struct {
+		name, dir string
+		ok        bool
+	}{
+		{"absolute", project, true},
+		{"relative", "project", true},
+		{"dotted", "./project/src/..", true},
+		{"symlink", filepath.Join(base, "link"), true},
+		{"relative symlink", "link", true},
+		{"missing", "nowhere", false},
+	}
+	for _, test := range tests {
+		got, err := canonicalProjectDir(test.dir)
+		switch {
+		case !test.ok && err == nil:
+			t.Errorf("%s: canonicalProjectDir(%q) = %s, want an error", test.name, test.dir, got)
+		case test.ok && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.ok && got != project:
+			t.Errorf("%s: canonicalProjectDir(%q) = %s, want %s", test.name, test.dir, got, project)
+		}
+	}
+}
+
+func TestDiscoveryOrder(t *testing.T) {
+	resetOptions(t)
+	project := t.TempDir()
+	pkg := filepath.Join(project, "src", "site")
+	//written in no particular order, in directories given out of order
+	files := map[string]string{}
+	for _, name := range []string{"z", "b", "m", "a", "k"} {
+		files["client/"+name+"/page.go"] = "package main\n"
+		files["client/"+name+".go"] = "package main\n"
+		files["pages/"+name+".json"] = "{}\n"
+		files["pages/"+name+".html"] = "\n"
+		files["pages/"+name+"/index.yaml"] = "a: 1\n"
+		files["pages/"+name+"/index.html"] = "\n"
+	}
+	writeFiles(t, pkg, files)
+	client := filepath.Join(pkg, "client")
+	gofiles, err := iterateDirs(nil, []string{filepath.Join(client, "m"), client, filepath.Join(client, "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonFiles, htmlFiles, err := findTemplates(project, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, list := range map[string][]string{"go files": gofiles, "data files": jsonFiles, "templates": htmlFiles} {
+		if !sort.StringsAreSorted(list) {
+			t.Errorf("%s out of order: %v", name, list)
+		}
+	}
+	if len(jsonFiles) != 10 || len(htmlFiles) != 10 {
+		t.Fatalf("found %d data files and %d templates, want 10 of each", len(jsonFiles), len(htmlFiles))
+	}
+	for i, json := range jsonFiles {
+		if strings.TrimSuffix(json, filepath.Ext(json)) != strings.TrimSuffix(htmlFiles[i], ".html") {
+			t.Errorf("data file %s paired with %s", json, htmlFiles[i])
+		}
+	}
+}
+
+func TestTrimSourcePaths(t *testing.T) {
+	resetOptions(t)
+	project := filepath.FromSlash("/home/ci/project")
+	saved := build.Default.GOPATH
+	defer func() { build.Default.GOPATH = saved }()
+	build.Default.GOPATH = filepath.FromSlash("/home/ci/go")
+	config.InheritGopath = true
+	goroot := filepath.ToSlash(runtime.GOROOT())
+	tests := []struct {
+		source interface{}
+		want   interface{}
+	}{
+		{"/home/ci/project/src/site/client/about.go", "src/site/client/about.go"},
+		{"/home/ci/project/vendor/src/lib/lib.go", "vendor/src/lib/lib.go"},
+		{"/home/ci/go/src/github.com/x/y.go", "gopath/src/github.com/x/y.go"},
+		{goroot + "/src/fmt/print.go", "goroot/src/fmt/print.go"},
+		{"/elsewhere/z.go", "/elsewhere/z.go"},
+		{"already/relative.go", "already/relative.go"},
+		{42.0, 42.0},
+	}
+	sources := []interface{}{}
+	for _, test := range tests {
+		sources = append(sources, test.source)
+	}
+	sourceMap := map[string]interface{}{"version": 3.0, "sources": sources}
+	trimSourcePaths(project, sourceMap)
+	for i, test := range tests {
+		if got := sourceMap["sources"].([]interface{})[i]; got != test.want {
+			t.Errorf("%v trimmed to %v, want %v", test.source, got, test.want)
+		}
+	}
+}
+
+func TestRunTrimPath(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	page := filepath.Join(project, "src", "site", "client", "about.go")
+	fake.run = func(call fakeCall, stdout io.Writer, stderr io.Writer) error {
+		for i, arg := range call.args {
+			if arg == "-o" {
+				sourceMap := fmt.Sprintf(`{"version": 3, "sources": [%q]}`, filepath.ToSlash(page))
+				if err := os.WriteFile(call.args[i+1]+".map", []byte(sourceMap), 0644); err != nil {
+					return err
+				}
+				return os.WriteFile(call.args[i+1], []byte("// js\n"), 0644)
+			}
+		}
+		return nil
+	}
+	if err := run(project, []string{"--dev", "--trim-path", "site"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(project, "src", "site", "static", "en", "web", "about.js.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"sources":["src/site/client/about.go"]`; !strings.Contains(string(data), want) {
+		t.Errorf("source map %s, want it to contain %s", data, want)
+	}
+}
+
+func TestTemplateForDataErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"post.json", `{"_template": "shared.html",}`, "post.json:1:"},
+		{"post.yaml", "_template: shared.html\n  bad: indent\n", "post.yaml:2:"},
+		{"post.json", `{"_template": "${GB_SEVEN5_TEST_UNSET}"}`, "GB_SEVEN5_TEST_UNSET is not set"},
+	}
+	for _, test := range tests {
+		resetOptions(t)
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{test.name: test.data, "shared.html": "\n"})
+		_, err := templateFor([]string{root}, filepath.Join(root, test.name))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: templateFor = %v, want the data error %q", test.data, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const manifestName = "build-manifest.json"
+
+// manifestEntry records one file produced by the build. Paths are relative
+// to the project directory and use forward slashes. Hash is the sha256 of
+// the output as it was when the manifest was written.
+type manifestEntry struct {
+	Source string `json:"source"`
+	Output string `json:"output"`
+	Step   string `json:"step"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// buildManifest collects the outputs of a package's build, keyed by output
+// path so that rebuilding a page (e.g. in watch mode) replaces its entry.
+type buildManifest struct {
+	project string
+	lock    sync.Mutex
+	entries map[string]manifestEntry
+}
+
+var (
+	manifests     = map[string]*buildManifest{}
+	manifestsLock sync.Mutex
+)
+
+func manifestFor(project string, arg string) *buildManifest {
+	manifestsLock.Lock()
+	defer manifestsLock.Unlock()
+	m, ok := manifests[arg]
+	if !ok {
+		m = &buildManifest{project: project, entries: map[string]manifestEntry{}}
+		manifests[arg] = m
+	}
+	return m
+}
+
+func (m *buildManifest) record(step string, source string, output string) {
+	entry := manifestEntry{
+		Source: projectRelative(m.project, source),
+		Output: projectRelative(m.project, output),
+		Step:   step,
+	}
+	m.add(entry)
+}
+
+func (m *buildManifest) add(entry manifestEntry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.entries[entry.Output] = entry
+}
+
+// has reports whether output, relative to the project, has been recorded.
+func (m *buildManifest) has(output string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.entries[output]
+	return ok
+}
+
+// sorted returns the entries ordered by output path so the manifest is
+// stable from one build to the next.
+func (m *buildManifest) sorted() []manifestEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	result := []manifestEntry{}
+	for _, entry := range m.entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Output < result[j].Output })
+	return result
+}
+
+// sortedUnder returns the sorted entries whose output is within dir, e.g.
+// those of one language's web directory.
+func (m *buildManifest) sortedUnder(dir string) []manifestEntry {
+	prefix := projectRelative(m.project, dir) + "/"
+	result := []manifestEntry{}
+	for _, entry := range m.sorted() {
+		if strings.HasPrefix(entry.Output, prefix) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func projectRelative(project string, path string) string {
+	rel, err := filepath.Rel(project, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func constructManifestPath(project string, arg string) string {
+	return filepath.Join(constructStaticPath(project, arg), manifestName)
+}
+
+// hashOutputs sets the hash of each entry from its output file; one that
+// can't be read, e.g. a directory, is left without.
+func (m *buildManifest) hashOutputs() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for output, entry := range m.entries {
+		entry.Hash = ""
+		if data, err := ioutil.ReadFile(filepath.Join(m.project, filepath.FromSlash(output))); err == nil {
+			sum := sha256.Sum256(data)
+			entry.Hash = hex.EncodeToString(sum[:])
+		}
+		m.entries[output] = entry
+	}
+}
+
+// writeManifest writes the manifest for arg atomically, so an interrupted
+// build never leaves a truncated manifest.
+func writeManifest(project string, arg string) error {
+	manifest := manifestFor(project, arg)
+	manifest.hashOutputs()
+	data, err := json.MarshalIndent(manifest.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(constructManifestPath(project, arg), append(data, '\n'))
+}
+
+// readManifest returns the entries of arg's manifest. If no manifest has
+// been written the error satisfies os.IsNotExist.
+func readManifest(project string, arg string) ([]manifestEntry, error) {
+	data, err := ioutil.ReadFile(constructManifestPath(project, arg))
+	if err != nil {
+		return nil, err
+	}
+	entries := []manifestEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// diffAgainst, if set, is a manifest from an earlier build to compare this
+// build's outputs with.
+var diffAgainst = ""
+
+// printManifestDiff prints each output of arg that was added, changed or
+// removed since the build that wrote the manifest at previous, compared by
+// content hash, one "added", "changed" or "removed" and project relative
+// path per line, so a deploy can upload just those. In json mode each is a
+// "diff" event.
+func printManifestDiff(project string, arg string, previous string) error {
+	data, err := ioutil.ReadFile(previous)
+	if err != nil {
+		return err
+	}
+	entries := []manifestEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("unable to parse %s: %v", previous, err)
+	}
+	before := map[string]string{}
+	for _, entry := range entries {
+		before[entry.Output] = entry.Hash
+	}
+	changes := []logEvent{}
+	for _, entry := range manifestFor(project, arg).sorted() {
+		hash, ok := before[entry.Output]
+		delete(before, entry.Output)
+		switch {
+		case !ok:
+			changes = append(changes, logEvent{Change: "added", Output: entry.Output})
+		case hash == "" || hash != entry.Hash:
+			changes = append(changes, logEvent{Change: "changed", Output: entry.Output}) //no hash, nothing to compare
+		}
+	}
+	for output := range before {
+		changes = append(changes, logEvent{Change: "removed", Output: output})
+	}
+	//by path, whatever the change
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Output < changes[j].Output })
+	for _, change := range changes {
+		if logFormat == "json" {
+			change.Event = "diff"
+			change.Package = arg
+			emit(os.Stdout, change)
+			continue
+		}
+		logf(os.Stdout, "%s %s\n", change.Change, change.Output)
+	}
+	return nil
+}
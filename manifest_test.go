@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// captureOutput returns what fn writes to *file, os.Stdout or os.Stderr.
+func captureOutput(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	defer func() { *file = saved }()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestPrintManifestDiff(t *testing.T) {
+	project := t.TempDir()
+	previous := filepath.Join(t.TempDir(), manifestName)
+	writeFiles(t, filepath.Dir(previous), map[string]string{manifestName: `[
+		{"source": "a.go", "output": "web/a.js", "step": "gopherjs", "hash": "1"},
+		{"source": "b.go", "output": "web/b.js", "step": "gopherjs", "hash": "2"},
+		{"source": "c.json", "output": "web/c.html", "step": "pagegen", "hash": "3"},
+		{"source": "d.json", "output": "web/d.html", "step": "pagegen"}
+	]`})
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"human", []string{"changed web/b.js", "removed web/c.html", "changed web/d.html", "added web/e.html"}},
+		{"json", []string{`"diff" "site" "changed" "web/b.js"`, `"diff" "site" "removed" "web/c.html"`,
+			`"diff" "site" "changed" "web/d.html"`, `"diff" "site" "added" "web/e.html"`}},
+	}
+	for _, test := range tests {
+		resetOptions(t)
+		logFormat = test.format
+		m := manifestFor(project, "site")
+		m.add(manifestEntry{Source: "a.go", Output: "web/a.js", Hash: "1"})
+		m.add(manifestEntry{Source: "b.go", Output: "web/b.js", Hash: "22"})
+		m.add(manifestEntry{Source: "d.json", Output: "web/d.html", Hash: "4"})
+		m.add(manifestEntry{Source: "e.json", Output: "web/e.html", Hash: "5"})
+		var err error
+		out := captureStdout(t, func() { err = printManifestDiff(project, "site", previous) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if test.format == "json" {
+			for i, line := range lines {
+				var event logEvent
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("%q: %v", line, err)
+				}
+				lines[i] = strings.Join([]string{`"` + event.Event + `"`, `"` + event.Package + `"`,
+					`"` + event.Change + `"`, `"` + event.Output + `"`}, " ")
+			}
+		}
+		if strings.Join(lines, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: printed\n%s\nwant\n%s", test.format, strings.Join(lines, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
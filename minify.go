@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// rawTextElements keep their content exactly as written when minifying.
+var rawTextElements = []string{"pre", "textarea", "script", "style"}
+
+// minifyHTML shrinks a generated page without changing how it renders:
+// comments are removed, except IE conditional comments, and each run of
+// whitespace between or around tags collapses to one space. Tags are passed
+// on unchanged, and so is the content of pre, textarea, script and style
+// elements.
+func minifyHTML(page []byte) []byte {
+	var out bytes.Buffer
+	s := string(page)
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			writeCollapsed(&out, s)
+			break
+		}
+		writeCollapsed(&out, s[:lt])
+		s = s[lt:]
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				out.WriteString(s) //unterminated, leave it be
+				break
+			}
+			comment := s[:4+end+3]
+			if strings.HasPrefix(comment, "<!--[if") || strings.HasPrefix(comment, "<!--<![endif]") {
+				out.WriteString(comment)
+			}
+			s = s[len(comment):]
+			if out.Len() > 0 && out.Bytes()[out.Len()-1] == ' ' {
+				s = strings.TrimLeft(s, " \t\n\r\f")
+			}
+			continue
+		}
+		tag := tagEnd(s)
+		out.WriteString(s[:tag])
+		name := tagName(s[:tag])
+		s = s[tag:]
+		for _, raw := range rawTextElements {
+			if name != raw {
+				continue
+			}
+			end := strings.Index(strings.ToLower(s), "</"+raw)
+			if end < 0 {
+				end = len(s)
+			}
+			out.WriteString(s[:end])
+			s = s[end:]
+			break
+		}
+	}
+	return out.Bytes()
+}
+
+// writeCollapsed writes text with each run of whitespace made one space.
+func writeCollapsed(out *bytes.Buffer, text string) {
+	space := false
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case ' ', '\t', '\n', '\r', '\f':
+			space = true
+		default:
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			out.WriteByte(c)
+		}
+	}
+	if space {
+		out.WriteByte(' ')
+	}
+}
+
+// tagEnd returns the length of the tag at the start of s, up to and
+// including its closing >, skipping any > in quoted attribute values.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// tagName returns the lower case element name of an opening tag, or "" for
+// a closing tag, doctype or the like.
+func tagName(tag string) string {
+	name := strings.TrimPrefix(tag, "<")
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name = name[:i]
+			break
+		}
+	}
+	return strings.ToLower(name)
+}
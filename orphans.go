@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkOrphans reports generated files in arg's output tree that the build
+// that just finished no longer produces, e.g. after a page was renamed, and
+// removes them under --prune.
+//
+// An orphan is a file the previous build manifest lists as generated that
+// the current build didn't generate. Unpruned orphans are carried into the
+// new manifest so they keep being reported and clean still removes them.
+// Without a previous manifest there is no record of what this tool wrote,
+// so any javascript, source map, or .html without a source is reported as
+// a possible orphan but never pruned: it may be hand-authored.
+func checkOrphans(project string, arg string) error {
+	current := manifestFor(project, arg)
+	previous, err := readManifest(project, arg)
+	if os.IsNotExist(err) {
+		langs, err := languagesFor(project, arg)
+		if err != nil {
+			return err
+		}
+		//the suffix layout's languages share one directory
+		if suffixLayout() {
+			langs = langs[:1]
+		}
+		return forEachLanguage(langs, func(lang string) error {
+			return reportPossibleOrphans(project, arg, lang, current)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range previous {
+		if current.has(entry.Output) {
+			continue
+		}
+		path := filepath.Join(project, filepath.FromSlash(entry.Output))
+		if _, err := os.Stat(path); err != nil {
+			continue //already gone
+		}
+		if !prune {
+			logAt(os.Stdout, severitySkipped, "gb seven5: orphaned output %s (from %s, use --prune to remove)\n", path, entry.Source)
+			current.add(entry)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if entry.Step == "gopherjs" {
+			os.Remove(path + ".map")
+		}
+		logAt(os.Stdout, severityDone, "gb seven5: pruned orphaned output %s\n", path)
+	}
+	return nil
+}
+
+func reportPossibleOrphans(project string, arg string, lang string, current *buildManifest) error {
+	orphans := []string{}
+	err := filepath.Walk(constructWebPath(project, arg, lang), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		output := path
+		switch {
+		case strings.HasSuffix(path, config.JSExtension+".map"):
+			output = strings.TrimSuffix(path, ".map")
+		case strings.HasSuffix(path, config.JSExtension), strings.HasSuffix(path, ".html"):
+		default:
+			return nil //css, images and so on are never generated
+		}
+		if !current.has(projectRelative(project, output)) {
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(orphans)
+	for _, orphan := range orphans {
+		logAt(os.Stdout, severitySkipped, "gb seven5: possibly orphaned output %s (no build manifest, so not pruned)\n", orphan)
+	}
+	return nil
+}
+
+// failOnOrphanHTML fails a build that has templates no page uses.
+var failOnOrphanHTML = false
+
+// orphanTemplates returns an error for each html file in arg's template
+// roots, outside the support directories, that is neither the template of
+// one of the pages findTemplates found nor named like one of them, e.g. a
+// page whose data file was forgotten. Such files are otherwise silently
+// left out of the build.
+func orphanTemplates(project string, arg string, jsonFiles []string, htmlFiles []string) []error {
+	used := map[string]bool{}
+	for _, html := range htmlFiles {
+		used[html] = true
+	}
+	//a template overridden in a later root is used under that name
+	for _, json := range jsonFiles {
+		rel := relativePath(templateRootOf(project, arg, json), json)
+		used[strings.TrimSuffix(rel, filepath.Ext(rel))] = true
+	}
+	ignore := ignoresFor(project, arg)
+	errs := []error{}
+	for _, templatePath := range constructTemplateRoots(project, arg) {
+		if _, err := os.Stat(templatePath); os.IsNotExist(err) {
+			continue
+		}
+		err := walkTree(templatePath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if skip, err := ignore.skip(path, info); skip {
+				return err
+			}
+			if info.IsDir() && (info.Name() == config.Layout.SupportDir || path == filepath.Join(templatePath, config.Layout.SupportDir)) {
+				return filepath.SkipDir
+			}
+			if info.IsDir() || filepath.Ext(path) != ".html" || used[path] {
+				return nil
+			}
+			rel := relativePath(templatePath, path)
+			if used[strings.TrimSuffix(rel, filepath.Ext(rel))] {
+				return nil
+			}
+			errs = append(errs, fmt.Errorf("%s has no data file or front matter, so no page uses it (--fail-on-orphan-html)", path))
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
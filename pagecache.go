@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	pageCacheName    = "pagegen-cache.json"
+	optionsCacheName = "gopherjs-options.json"
+)
+
+// pageCachePathFor returns arg's page cache for lang; languages other than
+// the configured one get their own, e.g. pagegen-cache.fr.json.
+func pageCachePathFor(project string, arg string, lang string) string {
+	return cachePathFor(project, arg, lang, pageCacheName)
+}
+
+// optionsCachePathFor returns the cache of the page options the scripts of
+// arg's lang were compiled with, named as the page cache is.
+func optionsCachePathFor(project string, arg string, lang string) string {
+	return cachePathFor(project, arg, lang, optionsCacheName)
+}
+
+func cachePathFor(project string, arg string, lang string, name string) string {
+	if lang != config.Language {
+		name = strings.TrimSuffix(name, ".json") + "." + lang + ".json"
+	}
+	return filepath.Join(constructStaticPath(project, arg), name)
+}
+
+// isCacheFile reports whether name, in the static directory, is one of
+// the caches: build bookkeeping rather than output.
+func isCacheFile(name string) bool {
+	for _, cache := range []string{pageCacheName, optionsCacheName} {
+		if strings.HasPrefix(name, strings.TrimSuffix(cache, ".json")) && strings.HasSuffix(name, ".json") {
+			return true
+		}
+	}
+	return false
+}
+
+// pageCache remembers, for each page pagegen last generated successfully,
+// a hash of that run's inputs, keyed by the project relative output path.
+// A page whose inputs hash the same is skipped, whatever the modification
+// times say. The options cache is one too, of the page options each script
+// was last compiled with.
+type pageCache struct {
+	Pages map[string]string `json:"pages"`
+
+	project  string
+	path     string
+	previous map[string]string
+	lock     sync.Mutex
+}
+
+// loadPageCache reads arg's page cache for lang; a missing or unreadable
+// one is just empty.
+func loadPageCache(project string, arg string, lang string) *pageCache {
+	return loadCache(project, pageCachePathFor(project, arg, lang))
+}
+
+// loadOptionsCache reads arg's page options cache for lang, as
+// loadPageCache does.
+func loadOptionsCache(project string, arg string, lang string) *pageCache {
+	return loadCache(project, optionsCachePathFor(project, arg, lang))
+}
+
+func loadCache(project string, path string) *pageCache {
+	cache := &pageCache{Pages: map[string]string{}, project: project, path: path}
+	saved := pageCache{}
+	data, err := ioutil.ReadFile(path)
+	if err == nil && json.Unmarshal(data, &saved) == nil {
+		cache.previous = saved.Pages
+	}
+	return cache
+}
+
+// fresh reports whether out was last generated from inputs with hash and
+// is still there.
+func (c *pageCache) fresh(out string, hash string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.previous[projectRelative(c.project, out)] != hash {
+		return false
+	}
+	_, err := os.Stat(out)
+	return err == nil
+}
+
+// changed reports whether hash differs from out's previous one; a page
+// that had none matches the empty hash.
+func (c *pageCache) changed(out string, hash string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.previous[projectRelative(c.project, out)] != hash
+}
+
+// set records that out has been generated from inputs with hash.
+func (c *pageCache) set(out string, hash string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.Pages[projectRelative(c.project, out)] = hash
+}
+
+// keep carries out's previous entry over, for a page this build left alone.
+func (c *pageCache) keep(out string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := projectRelative(c.project, out)
+	if hash, ok := c.previous[key]; ok {
+		c.Pages[key] = hash
+	}
+}
+
+func (c *pageCache) save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, append(data, '\n'))
+}
+
+// hashInputs hashes the names and contents of files, which must all
+// exist, along with the settings in extra.
+func hashInputs(files []string, extra ...string) (string, error) {
+	h := sha256.New()
+	for _, s := range extra {
+		fmt.Fprintf(h, "%q\n", s)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%q\n", file)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// supportDigest hashes every file in arg's support directories, or returns
+// "" if there are none.
+//
+// This digest goes into the input hash of every page in the package. Which
+// support files a template pulls in is up to pagegen, and working that out
+// here would mean following its include syntax through every partial, so
+// the dependency is deliberately conservative: each page is taken to depend
+// on every support file, and changing any of them regenerates all pages.
+func supportDigest(project string, arg string) (string, error) {
+	byName, err := supportFiles(project, arg)
+	if err != nil || len(byName) == 0 {
+		return "", err
+	}
+	//the files that are used, so an override counts but what it hides doesn't
+	files := []string{}
+	for _, file := range byName {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return hashInputs(files)
+}
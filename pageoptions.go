@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pageOptionsSuffix names a page's own gopherjs options, beside it: e.g.
+// about.gopherjs.json for about.go.
+const pageOptionsSuffix = ".gopherjs.json"
+
+// pageOptions are a page's own gopherjs options, merged over those of the
+// command line for its compile alone. The file is a json object whose keys
+// are "tags", replacing --tags, "ldflags", -X settings added to --ldflags,
+// and the names of the gopherjsOptions, e.g. "localmap": true. Which files
+// are pages is still decided by --tags.
+type pageOptions struct {
+	tags    *string
+	ldflags string
+	set     map[string]bool
+}
+
+func pageOptionsPath(page string) string {
+	return strings.TrimSuffix(page, ".go") + pageOptionsSuffix
+}
+
+// readPageOptions reads the options beside page, which needn't exist.
+func readPageOptions(page string) (pageOptions, error) {
+	result := pageOptions{set: map[string]bool{}}
+	path := pageOptionsPath(page)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return result, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names) //report the same bad key every time
+	for _, name := range names {
+		if err := result.parse(name, fields[name]); err != nil {
+			return result, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return result, nil
+}
+
+func (o *pageOptions) parse(name string, value json.RawMessage) error {
+	dec := func(v interface{}) error {
+		return json.NewDecoder(bytes.NewReader(value)).Decode(v)
+	}
+	switch name {
+	case "tags":
+		var pageTags string
+		if err := dec(&pageTags); err != nil {
+			return err
+		}
+		o.tags = &pageTags
+		return nil
+	case "ldflags":
+		if err := dec(&o.ldflags); err != nil {
+			return err
+		}
+		return validateXSettings(o.ldflags)
+	}
+	for _, option := range gopherjsOptions {
+		if option.name != name {
+			continue
+		}
+		var on bool
+		if err := dec(&on); err != nil {
+			return err
+		}
+		if on && !dev && name == "localmap" {
+			return fmt.Errorf("needs --dev, production builds have no source maps")
+		}
+		o.set[name] = on
+		return nil
+	}
+	return fmt.Errorf("unknown option")
+}
+
+// buildTags returns the tags the page is compiled with.
+func (o pageOptions) buildTags() []string {
+	if o.tags != nil {
+		return strings.Fields(*o.tags)
+	}
+	return strings.Fields(tags)
+}
+
+// isSet reports whether the gopherjs option named name is on for the page.
+func (o pageOptions) isSet(name string, global bool) bool {
+	if on, ok := o.set[name]; ok {
+		return on
+	}
+	return global
+}
+
+// String returns the options in a fixed order, or "" for a page without
+// any, for telling when they change.
+func (o pageOptions) String() string {
+	fields := []string{}
+	if o.tags != nil {
+		fields = append(fields, fmt.Sprintf("tags=%q", *o.tags))
+	}
+	if o.ldflags != "" {
+		fields = append(fields, fmt.Sprintf("ldflags=%q", o.ldflags))
+	}
+	names := []string{}
+	for name := range o.set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, fmt.Sprintf("%s=%v", name, o.set[name]))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPageOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		sidecar string
+		want    string
+	}{
+		{"unknown key", nil, `{"tgas": "x"}`, "about.gopherjs.json: tgas: unknown option"},
+		{"first bad key", nil, `{"zz": 1, "aa": 1}`, "about.gopherjs.json: aa: unknown option"},
+		{"bad type", nil, `{"tags": true}`, "about.gopherjs.json: tags: json: cannot unmarshal bool"},
+		{"bad ldflags", nil, `{"ldflags": "-s"}`, "about.gopherjs.json: ldflags:"},
+		{"localmap without dev", nil, `{"localmap": true}`, "about.gopherjs.json: localmap: needs --dev"},
+		{"not an object", nil, `["tags"]`, "unable to parse"},
+		{"malformed", []string{"--dev"}, `{"tags": `, "unable to parse"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetOptions(t)
+			if _, err := parseFlags(test.flags); err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			page := filepath.Join(dir, "about.go")
+			writeFiles(t, dir, map[string]string{"about.gopherjs.json": test.sidecar})
+			_, err := readPageOptions(page)
+			if err == nil {
+				t.Fatalf("read %s without an error", test.sidecar)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error %q, want it to contain %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestPageOptionsString(t *testing.T) {
+	tests := []struct {
+		name    string
+		sidecar string
+		want    string
+	}{
+		{"none", "", ""},
+		{"empty object", "{}", ""},
+		{"empty tags", `{"tags": ""}`, `tags=""`},
+		{"all", `{"localmap": false, "ldflags": "-X main.A=1", "tags": "a b", "gopherjs-quiet": true}`,
+			`tags="a b" ldflags="-X main.A=1" gopherjs-quiet=true localmap=false`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetOptions(t)
+			dir := t.TempDir()
+			if test.sidecar != "" {
+				writeFiles(t, dir, map[string]string{"about.gopherjs.json": test.sidecar})
+			}
+			options, err := readPageOptions(filepath.Join(dir, "about.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := options.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunPageOptionsStaleness(t *testing.T) {
+	fake := useFakeRunner(t)
+	withTools(t)
+	project := newTestProject(t, "site")
+	sidecar := filepath.Join(project, "src", "site", "client", "about.gopherjs.json")
+	steps := []struct {
+		name    string
+		edit    func() error
+		compile bool
+	}{
+		{"first build", func() error { return nil }, true},
+		{"unchanged", func() error { return nil }, false},
+		{"sidecar added", func() error { return os.WriteFile(sidecar, []byte(`{"tags": "x"}`), 0644) }, true},
+		{"unchanged sidecar", func() error { return nil }, false},
+		{"sidecar changed", func() error { return os.WriteFile(sidecar, []byte(`{"tags": "y"}`), 0644) }, true},
+		{"sidecar deleted", func() error { return os.Remove(sidecar) }, true},
+		{"unchanged again", func() error { return nil }, false},
+	}
+	for _, step := range steps {
+		if err := step.edit(); err != nil {
+			t.Fatal(err)
+		}
+		before := len(builds(fake))
+		if err := run(project, []string{"site"}); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if compiled := len(builds(fake)) > before; compiled != step.compile {
+			t.Errorf("%s: compiled %v, want %v", step.name, compiled, step.compile)
+		}
+	}
+	if _, err := os.Stat(optionsCachePathFor(project, "site", config.Language)); err != nil {
+		t.Errorf("no options cache: %v", err)
+	}
+}
+
+// builds returns the gopherjs compiles among fake's calls, leaving out the
+// version check.
+func builds(fake *fakeRunner) []fakeCall {
+	result := []fakeCall{}
+	for _, call := range fake.commands("gopherjs") {
+		if len(call.args) > 0 && call.args[0] == "build" {
+			result = append(result, call)
+		}
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stringList is a flag.Value collecting each use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// selectedPages holds the --page names; when there are any only pages whose
+// source or data file has one of those base names are built.
+var selectedPages stringList
+
+// pageSelected reports whether the page built from source, a page's go file
+// or a data file, is to be built.
+func pageSelected(source string) bool {
+	if len(selectedPages) == 0 {
+		return true
+	}
+	name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	for _, selected := range selectedPages {
+		if name == selected {
+			return true
+		}
+	}
+	return false
+}
+
+// keepUnselected records the existing output of a page left out by --page,
+// so that this partial build doesn't drop it from the manifest or treat it
+// as orphaned.
+func keepUnselected(project string, arg string, step string, source string, target string) {
+	if _, err := os.Stat(target); err == nil {
+		manifestFor(project, arg).record(step, source, target)
+	}
+}
+
+// keepSkippedOutputs records, from the last manifest, the outputs of steps
+// for arg's lang that still exist; a --no-js or --no-html build uses it for
+// the phase it skips, as keepUnselected is used for pages.
+func keepSkippedOutputs(project string, arg string, lang string, steps ...string) error {
+	entries, err := readManifest(project, arg)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	prefix := projectRelative(project, constructWebPath(project, arg, lang)) + "/"
+	manifest := manifestFor(project, arg)
+	for _, entry := range entries {
+		if !containsString(steps, entry.Step) || !strings.HasPrefix(entry.Output, prefix) {
+			continue
+		}
+		if suffixLayout() && outputLanguage(entry.Output) != lang {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(project, filepath.FromSlash(entry.Output))); err == nil {
+			entry.Hash = ""
+			manifest.add(entry)
+		}
+	}
+	return nil
+}
+
+// nothingToBuild notes a phase of arg that found nothing to build, which is
+// more likely a misconfigured package than one meant to be empty: a
+// warning, once per package, or under --strict an error.
+func nothingToBuild(arg string, problem string) error {
+	if strict {
+		return fmt.Errorf("%s (--strict)", problem)
+	}
+	emptyLock.Lock()
+	defer emptyLock.Unlock()
+	if !warnedEmpty[arg+"\x00"+problem] {
+		warnedEmpty[arg+"\x00"+problem] = true
+		logAt(os.Stderr, severityWarning, "gb seven5: warning: %s: %s\n", arg, problem)
+	}
+	return nil
+}
+
+var (
+	warnedEmpty = map[string]bool{}
+	emptyLock   sync.Mutex
+)
+
+// validateSelectedPages fails if a --page name matches no page or template
+// in arg, which is more likely a typo than a request to build nothing.
+func validateSelectedPages(project string, arg string) error {
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return err
+	}
+	sources, err := findPages(gofiles)
+	if err != nil {
+		return err
+	}
+	jsonFiles, _, err := findTemplates(project, arg)
+	if err != nil {
+		return err
+	}
+	sources = append(sources, jsonFiles...)
+	for _, selected := range selectedPages {
+		found := false
+		for _, source := range sources {
+			if strings.TrimSuffix(filepath.Base(source), filepath.Ext(source)) == selected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err := fmt.Errorf("no page or template named %q in %s", selected, arg)
+			logf(os.Stderr, "%v\n", err)
+			return err
+		}
+	}
+	return nil
+}
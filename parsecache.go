@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sync"
+)
+
+// maxParsedFiles bounds the parse cache; past it, the cache starts over.
+const maxParsedFiles = 4096
+
+// parsedFile is what hasMainFunc needs from a go file, as of the content
+// it was parsed with. As with the page cache, the content rather than the
+// modification time decides, so an edit that keeps the size and lands in
+// the same clock tick is still seen.
+type parsedFile struct {
+	hash   [sha256.Size]byte
+	isMain bool //package main with a main func
+}
+
+var (
+	parsed     = map[string]parsedFile{}
+	parsedLock sync.Mutex
+)
+
+// declaresMain reports whether the go file at path is package main and
+// has a main func. Files are parsed again only once they change, since
+// the pages are looked for several times a build and on every rebuild
+// while watching.
+func declaresMain(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(data)
+	parsedLock.Lock()
+	cached, ok := parsed[path]
+	parsedLock.Unlock()
+	if ok && cached.hash == hash {
+		return cached.isMain, nil
+	}
+
+	fset := token.NewFileSet() // positions are relative to fset
+	f, err := parser.ParseFile(fset, path, data, 0)
+	if err != nil {
+		return false, err
+	}
+	isMain := false
+	//only package main produces a runnable page
+	if f.Name.Name == "main" {
+		for _, decl := range f.Decls {
+			if x, ok := decl.(*ast.FuncDecl); ok && x.Recv == nil && x.Name.String() == "main" {
+				isMain = true
+				break
+			}
+		}
+	}
+
+	parsedLock.Lock()
+	defer parsedLock.Unlock()
+	if len(parsed) >= maxParsedFiles {
+		parsed = map[string]parsedFile{}
+	}
+	parsed[path] = parsedFile{hash, isMain}
+	return isMain, nil
+}
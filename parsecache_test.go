@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeclaresMainSeesSameSizeEdits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "about.go")
+	stamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"package main\n\nfunc main() {}\n", true},
+		{"package main\n\nfunc mian() {}\n", false},
+		{"package mine\n\nfunc main() {}\n", false},
+		{"package main\n\nfunc main() {}\n", true},
+	}
+	for _, test := range tests {
+		//every version has the same size and modification time
+		writeFiles(t, dir, map[string]string{"about.go": test.source})
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+		got, err := declaresMain(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("declaresMain with %q = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// cpuProfile and traceFile, if set, are where a cpu profile and an
+// execution trace of gb seven5 itself are written; the gopherjs and pagegen
+// it runs are separate processes, so only the time spent waiting on them
+// shows.
+var cpuProfile = ""
+var traceFile = ""
+
+// startProfiling starts the profiles asked for and returns what stops
+// them, flushing each to its file; run defers it, so that a failed build is
+// profiled too.
+func startProfiling() (func(), error) {
+	stops := []func(){}
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			logf(os.Stderr, "unable to create cpu profile: %v\n", err)
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			logf(os.Stderr, "unable to start cpu profile: %v\n", err)
+			return nil, err
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			closeProfile(f)
+		})
+	}
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			stop()
+			logf(os.Stderr, "unable to create trace: %v\n", err)
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			logf(os.Stderr, "unable to start trace: %v\n", err)
+			return nil, err
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			closeProfile(f)
+		})
+	}
+	return stop, nil
+}
+
+func closeProfile(f *os.File) {
+	if err := f.Close(); err != nil {
+		logAt(os.Stderr, severityWarning, "gb seven5: warning: unable to write %s: %v\n", f.Name(), err)
+	}
+}
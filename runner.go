@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Runner runs an external command to completion, connecting its output to
+// stdout and stderr as it is produced. A nil env means the command inherits
+// this process's environment, and a nil stdin gives it no input. The
+// command is killed if ctx is done first.
+type Runner interface {
+	Run(ctx context.Context, name string, args []string, env []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+}
+
+// runner is used for every gopherjs and pagegen invocation; tests replace
+// it with a fake to inspect the command lines without the real binaries.
+var runner Runner = execRunner{}
+
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args []string, env []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	//don't wait forever on output from a killed process's children
+	cmd.WaitDelay = time.Second
+	return cmd.Run()
+}
+
+// runWithTimeout runs the command with the --timeout limit applied,
+// reporting a timeout as such rather than as the kill signal's exit status.
+func runWithTimeout(ctx context.Context, name string, args []string, env []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := runner.Run(ctx, name, args, env, stdin, stdout, stderr)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return &timeoutError{name, timeout}
+	}
+	return err
+}
+
+type timeoutError struct {
+	name  string
+	after time.Duration
+}
+
+func (t *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", t.name, t.after)
+}
+
+// lineWriter passes each complete line written to it on to w, one
+// logOutput call per line, so that the output of pages built concurrently
+// stays readable. With --tool-output grouped the lines are held until
+// Flush, which passes them on as one block.
+type lineWriter struct {
+	name string
+	w    io.Writer
+	buf  []byte
+	held []string
+}
+
+func newLineWriter(w io.Writer, name string) *lineWriter {
+	return &lineWriter{name: name, w: w}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.line(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (l *lineWriter) line(line string) {
+	if toolOutput == "grouped" {
+		l.held = append(l.held, line)
+		return
+	}
+	logOutput(l.w, l.name, line)
+}
+
+// Flush writes out a final line that had no trailing newline, and any
+// lines held back.
+func (l *lineWriter) Flush() {
+	if len(l.buf) > 0 {
+		l.line(string(l.buf))
+		l.buf = nil
+	}
+	if len(l.held) > 0 {
+		logOutputBlock(l.w, l.name, l.held)
+		l.held = nil
+	}
+}
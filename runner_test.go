@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCall is one command a fakeRunner was asked to run.
+type fakeCall struct {
+	name string
+	args []string
+	env  []string
+}
+
+// fakeRunner records the commands it is given instead of running them. A
+// gopherjs build writes a stub script to its -o file and pagegen prints a
+// stub page, unless run says otherwise.
+type fakeRunner struct {
+	lock  sync.Mutex
+	calls []fakeCall
+	run   func(call fakeCall, stdout io.Writer, stderr io.Writer) error
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args []string, env []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	call := fakeCall{name, append([]string{}, args...), env}
+	f.lock.Lock()
+	f.calls = append(f.calls, call)
+	f.lock.Unlock()
+	if f.run != nil {
+		return f.run(call, stdout, stderr)
+	}
+	switch filepath.Base(name) {
+	case "gopherjs":
+		for i, arg := range args {
+			if arg == "-o" && i+1 < len(args) {
+				return ioutil.WriteFile(args[i+1], []byte("// js\n"), 0644)
+			}
+		}
+	case "pagegen":
+		fmt.Fprintf(stdout, "<html><body>page</body></html>\n")
+	}
+	return nil
+}
+
+// commands returns the calls of the tool named name.
+func (f *fakeRunner) commands(name string) []fakeCall {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := []fakeCall{}
+	for _, call := range f.calls {
+		if filepath.Base(call.name) == name {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+// useFakeRunner puts the option variables and config back to their
+// defaults and replaces runner with a fake for the rest of the test.
+func useFakeRunner(t *testing.T) *fakeRunner {
+	t.Helper()
+	resetOptions(t)
+	fake := &fakeRunner{}
+	saved := runner
+	runner = fake
+	t.Cleanup(func() { runner = saved })
+	return fake
+}
+
+func resetOptions(t *testing.T) {
+	t.Helper()
+	if _, err := parseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	config = defaultConfig()
+	manifests = map[string]*buildManifest{}
+}
+
+// writeFiles creates files, by slash separated path relative to dir, with
+// the given contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGopherjsBuildArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  string
+	}{
+		{"production", nil, "build -m -o out.js page.go"},
+		{"dev", []string{"--dev"}, "build -s -o out.js page.go"},
+		{"tags", []string{"--tags", "a  b"}, "build -m -tags a b -o out.js page.go"},
+		{"pass through", []string{"--dev", "--localmap", "--gopherjs-quiet"}, "build -s --localmap -q -o out.js page.go"},
+		{"ldflags", []string{"--ldflags", "-X main.A=1", "--build-id", "42"}, "build -m -ldflags -X main.A=1 -X main.BuildID=42 -o out.js page.go"},
+	}
+	for _, test := range tests {
+		resetOptions(t)
+		if _, err := parseFlags(test.flags); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got := strings.Join(gopherjsBuildArgs("out.js", "page.go", pageOptions{}), " ")
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLaunchGopherjsRunsBuild(t *testing.T) {
+	fake := useFakeRunner(t)
+	project := t.TempDir()
+	gopherjsCache = filepath.Join(project, "cache")
+	out := filepath.Join(project, "about.js")
+	if err := launchGopherjs(context.Background(), project, "about", gopherjsBuildArgs(out, "about.go", pageOptions{})...); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.commands("gopherjs")
+	if len(calls) != 1 {
+		t.Fatalf("got %d gopherjs runs, want 1", len(calls))
+	}
+	want := []string{"build", "-m", "-o", out, "about.go"}
+	if !reflect.DeepEqual(calls[0].args, want) {
+		t.Errorf("got %q, want %q", calls[0].args, want)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("no output: %v", err)
+	}
+}
+
+func TestLaunchPagegen(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  []string
+	}{
+		{"managed flags", nil,
+			[]string{"--support", "support", "--dir", "/p/pages", "--start", "/index.html", "--json", "/index.json"}},
+		{"extra args", []string{"--pagegen-arg", "--lang=fr", "--pagegen-arg", "x"},
+			[]string{"--support", "support", "--dir", "/p/pages", "--start", "/index.html", "--json", "/index.json", "--lang=fr", "x"}},
+	}
+	for _, test := range tests {
+		fake := useFakeRunner(t)
+		if _, err := parseFlags(test.flags); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		out := filepath.Join(t.TempDir(), "index.html")
+		if err := launchPagegen(context.Background(), "support", "/p/pages", "/index.html", "/index.json", out); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		calls := fake.commands("pagegen")
+		if len(calls) != 1 || !reflect.DeepEqual(calls[0].args, test.want) {
+			t.Errorf("%s: got %v, want one run with %q", test.name, calls, test.want)
+		}
+		if data, err := ioutil.ReadFile(out); err != nil || !strings.Contains(string(data), "page") {
+			t.Errorf("%s: page not written: %q, %v", test.name, data, err)
+		}
+	}
+}
+
+func TestLaunchGopherjsGopath(t *testing.T) {
+	project := t.TempDir()
+	vendor := filepath.Join(project, "vendor")
+	list := func(dirs ...string) string { return strings.Join(dirs, string(os.PathListSeparator)) }
+	tests := []struct {
+		name    string
+		inherit bool
+		gopath  string
+		want    string
+	}{
+		{"project only", false, list("/go"), list(project, vendor)},
+		{"inherited", true, list("/go", "/work/"), list(project, vendor, "/go", "/work")},
+		{"relative entries dropped", true, list("go", "/go"), list(project, vendor, "/go")},
+		{"no duplicates", true, list(project, "/go", "/go/"), list(project, vendor, "/go")},
+		{"empty", true, "", list(project, vendor)},
+	}
+	saved := build.Default.GOPATH
+	defer func() { build.Default.GOPATH = saved }()
+	for _, test := range tests {
+		fake := useFakeRunner(t)
+		gopherjsCache = filepath.Join(t.TempDir(), "cache")
+		config.InheritGopath = test.inherit
+		build.Default.GOPATH = test.gopath
+		if err := launchGopherjs(context.Background(), project, "about", "build", "about.go"); err != nil {
+			t.Fatal(err)
+		}
+		calls := fake.commands("gopherjs")
+		if len(calls) != 1 {
+			t.Fatalf("%s: got %d gopherjs runs, want 1", test.name, len(calls))
+		}
+		//the last setting is the one the process sees
+		got := ""
+		for _, env := range calls[0].env {
+			if strings.HasPrefix(env, "GOPATH=") {
+				got = strings.TrimPrefix(env, "GOPATH=")
+			}
+		}
+		if got != test.want {
+			t.Errorf("%s: GOPATH=%s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// serveAddr is where the serve subcommand listens.
+var serveAddr = ":8080"
+
+// reloadPath is the event stream that served pages listen on to reload.
+const reloadPath = "/.seven5/reload"
+
+// reloadSnippet is added to every page served, so it reloads itself after a
+// rebuild; it uses server-sent events, which need nothing beyond net/http.
+const reloadSnippet = `<script>new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+// afterRebuild, if set, is called each time the watcher finishes rebuilding.
+var afterRebuild func()
+
+// servePackage builds arg, serves the web directory of its first language
+// over http and then watches it, rebuilding on changes and reloading the
+// pages open in a browser. It returns once SIGINT or SIGTERM has shut the server down.
+func servePackage(project string, args []string) error {
+	if len(args) != 1 {
+		err := fmt.Errorf("serve takes one package, got %d", len(args))
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	if failFast || maxErrors > 0 {
+		err := errors.New("--fail-fast and --max-errors can't be used with serve, which has to carry on after a failure")
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	if dryRun {
+		err := errors.New("--dry-run can't be used with serve, which needs the output")
+		logf(os.Stderr, "%v\n", err)
+		return err
+	}
+	arg := args[0]
+	watch = true //a failed build is only reported, as when watching
+	start := time.Now()
+	logPackageErrors(buildPackages(project, args))
+	printTimingSummary(time.Since(start))
+	warnCommonImports()
+	if buildContext.Err() != nil {
+		return nil
+	}
+
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return err
+	}
+	web := constructWebPath(project, arg, langs[0])
+	broker := &reloadBroker{clients: map[chan struct{}]bool{}}
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, broker)
+	mux.Handle("/", pageServer{web: web, files: http.FileServer(http.Dir(web))})
+	server := &http.Server{Addr: serveAddr, Handler: mux}
+	listener, err := net.Listen("tcp", serveAddr)
+	if err != nil {
+		logf(os.Stderr, "unable to listen on %s: %v\n", serveAddr, err)
+		return err
+	}
+	logf(os.Stdout, "gb seven5: serving %s at http://%s/\n", web, displayAddr(listener.Addr()))
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	afterRebuild = broker.reload
+	watchPackages(project, args)
+	afterRebuild = nil
+
+	//the watcher returns once the build is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	broker.close()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// displayAddr returns addr as something to put in a URL, localhost when
+// listening on every interface.
+func displayAddr(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// pageServer serves the web directory, adding reloadSnippet to each html
+// page on the way out; the files on disk are left as built. A path with
+// no extension is also tried as a .html page, as a CDN may be set up to.
+type pageServer struct {
+	web   string
+	files http.Handler
+}
+
+func (s pageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Join(s.web, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		name = filepath.Join(name, "index.html")
+	} else if err != nil && filepath.Ext(name) == "" {
+		name += ".html"
+	}
+	if filepath.Ext(name) != ".html" {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+	page, err := ioutil.ReadFile(name)
+	if err != nil {
+		s.files.ServeHTTP(w, r) //for its not found and redirects
+		return
+	}
+	if end := bytes.LastIndex(bytes.ToLower(page), []byte("</body>")); end >= 0 {
+		page = append(page[:end:end], append([]byte(reloadSnippet), page[end:]...)...)
+	} else {
+		page = append(page, reloadSnippet...)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(page)
+}
+
+// reloadBroker keeps the event streams of the open pages and tells them
+// all to reload after a rebuild.
+type reloadBroker struct {
+	lock    sync.Mutex
+	clients map[chan struct{}]bool
+	closed  bool
+}
+
+func (b *reloadBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	reload := make(chan struct{}, 1)
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.clients[reload] = true
+	b.lock.Unlock()
+	defer func() {
+		b.lock.Lock()
+		delete(b.clients, reload)
+		b.lock.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, open := <-reload:
+			if !open {
+				return
+			}
+			fmt.Fprintf(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (b *reloadBroker) reload() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for client := range b.clients {
+		select {
+		case client <- struct{}{}:
+		default: //already has a reload pending
+		}
+	}
+}
+
+// close ends every event stream, so shutting the server down isn't held up
+// by pages that are still open.
+func (b *reloadBroker) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for client := range b.clients {
+		close(client)
+		delete(b.clients, client)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const sitemapName = "sitemap.xml"
+
+func constructSitemapPath(project string, arg string, lang string) string {
+	return filepath.Join(constructWebPath(project, arg, lang), languageSuffix(sitemapName, lang))
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+func validateSitemapBase(base string) error {
+	u, err := url.Parse(base)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("--sitemap needs an absolute base URL like https://example.com, got %q", base)
+	}
+	return nil
+}
+
+// writeSitemap writes sitemap.xml to the root of the web directory of arg's
+// lang, listing each page pagegen generated as a URL under base, with the
+// output file's modification time as its lastmod.
+func writeSitemap(project string, arg string, lang string, base string) error {
+	web := constructWebPath(project, arg, lang)
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	//sorted by output path, so the sitemap only changes with the pages
+	for _, entry := range manifestFor(project, arg).sortedUnder(web) {
+		if entry.Step != "pagegen" || (suffixLayout() && outputLanguage(entry.Output) != lang) {
+			continue
+		}
+		out := filepath.Join(project, filepath.FromSlash(entry.Output))
+		info, err := os.Stat(out)
+		if err != nil {
+			return err
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     strings.TrimSuffix(base, "/") + "/" + pageURLPath(webRelative(web, out)),
+			LastMod: info.ModTime().UTC().Format(time.RFC3339),
+		})
+	}
+	data, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	sitemap := constructSitemapPath(project, arg, lang)
+	manifestFor(project, arg).record("sitemap", web, sitemap)
+	if old, err := ioutil.ReadFile(sitemap); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	logAt(os.Stdout, severityDone, "gb seven5: writing %s\n", sitemap)
+	return writeFileAtomic(sitemap, data)
+}
+
+// pageURLPath returns the URL path, without the leading slash, that serves
+// the page at rel, a slash separated path relative to the web directory.
+// Under --pretty-urls an index.html is served as its directory.
+func pageURLPath(rel string) string {
+	if prettyURLs && path.Base(rel) == "index.html" {
+		rel = strings.TrimSuffix(rel, "index.html")
+	}
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
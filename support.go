@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// copySupportAssets copies the files in the support directories that match
+// the support_assets patterns of the config into the output tree, at the
+// same place relative to the web directory as they have relative to their
+// template root; a file in a later root wins. Support files are otherwise
+// only pagegen includes, so nothing is copied unless the project asks for
+// it.
+func copySupportAssets(project string, arg string, lang string) error {
+	if len(config.SupportAssets) == 0 {
+		return nil
+	}
+	files, err := supportFiles(project, arg)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for rel := range files {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	for _, rel := range names {
+		if !isSupportAsset(filepath.ToSlash(rel)) {
+			continue
+		}
+		if err := copySupportAsset(project, arg, lang, files[rel]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySupportAsset copies the support file p to its place in the output.
+func copySupportAsset(project string, arg string, lang string, p string) error {
+	target := htmlTarget(project, arg, lang, p)
+	manifestFor(project, arg).record("copy", p, target)
+	if !force && !fileAfter(p, modTime(target)) {
+		return nil
+	}
+	if dryRun {
+		logAt(os.Stdout, severityCommand, "gb seven5: would copy %s to %s\n", p, target)
+		return nil
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	logAt(os.Stdout, severityDone, "gb seven5: copying %s\n", target)
+	return writeFileAtomic(target, data)
+}
+
+// isSupportAsset matches rel, a slash separated path within the support
+// directory, against the configured patterns. Patterns without a slash
+// match the file's base name at any depth, so "*.css" matches every
+// stylesheet while "fonts/*" matches only the fonts directory.
+func isSupportAsset(rel string) bool {
+	for _, pattern := range config.SupportAssets {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// modTime returns the modification time of path, or the zero time if it
+// can't be read.
+func modTime(path string) (t time.Time) {
+	if info, err := os.Stat(path); err == nil {
+		t = info.ModTime()
+	}
+	return t
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// constructTemplateRoots returns arg's template directories in the order
+// they are walked: those of template_dirs in the config, or just the pages
+// directory.
+func constructTemplateRoots(project string, arg string) []string {
+	if len(config.Layout.TemplateDirs) == 0 {
+		return []string{constructTemplatesPath(project, arg)}
+	}
+	roots := []string{}
+	for _, dir := range config.Layout.TemplateDirs {
+		roots = append(roots, filepath.Join(constructPackagePath(project, arg), filepath.FromSlash(dir)))
+	}
+	return roots
+}
+
+// validateTemplateRoots fails if a template directory of arg is outside
+// the project or can't be read; like the pages directory, each one is
+// optional.
+func validateTemplateRoots(project string, arg string) error {
+	for _, root := range constructTemplateRoots(project, arg) {
+		if rel, err := filepath.Rel(project, root); err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("template directory %s is outside the project", root)
+		}
+		if _, err := os.Stat(root); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateRootOf returns the template directory of arg that path is in.
+func templateRootOf(project string, arg string, path string) string {
+	roots := constructTemplateRoots(project, arg)
+	best := roots[0]
+	found := false
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		//a root may be inside another, the innermost one is the page's
+		if !found || len(root) > len(best) {
+			best, found = root, true
+		}
+	}
+	return best
+}
+
+// constructSupportPaths returns the support directory of each of arg's
+// template roots, in order, whether or not it exists.
+func constructSupportPaths(project string, arg string) []string {
+	dirs := []string{}
+	for _, root := range constructTemplateRoots(project, arg) {
+		dirs = append(dirs, filepath.Join(root, config.Layout.SupportDir))
+	}
+	return dirs
+}
+
+// supportFiles returns the files of arg's support directories by their
+// path within them; a file in a later root replaces one of the same name
+// in an earlier root.
+func supportFiles(project string, arg string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, support := range constructSupportPaths(project, arg) {
+		err := filepath.Walk(support, func(p string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) && p == support {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				files[relativePath(support, p)] = p
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// prepareSupport returns the support directory that pagegen includes come
+// from for arg. With more than one template root that has one, it is a
+// merge of them all in a scratch directory under the web directory, to be
+// removed with the returned cleanup. It is "" when there are none.
+func prepareSupport(project string, arg string, lang string) (string, func(), error) {
+	existing := []string{}
+	for _, support := range constructSupportPaths(project, arg) {
+		if _, err := os.Stat(support); err == nil {
+			existing = append(existing, support)
+		}
+	}
+	switch {
+	case len(existing) == 0:
+		return "", func() {}, nil
+	case len(existing) == 1 || dryRun:
+		return existing[len(existing)-1], func() {}, nil
+	}
+	files, err := supportFiles(project, arg)
+	if err != nil {
+		return "", nil, err
+	}
+	web := constructWebPath(project, arg, lang)
+	if err := os.MkdirAll(web, 0755); err != nil {
+		return "", nil, err
+	}
+	merged, err := ioutil.TempDir(web, ".seven5-support-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(merged) }
+	for rel, source := range files {
+		data, err := ioutil.ReadFile(source)
+		if err == nil {
+			err = os.MkdirAll(filepath.Join(merged, filepath.Dir(rel)), 0755)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(merged, rel), data, 0644)
+		}
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return merged, cleanup, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowestSteps is how many of the slowest steps the -v summary lists.
+const slowestSteps = 5
+
+// stepTiming is the wall-clock time one gopherjs or pagegen run took.
+type stepTiming struct {
+	step    string
+	target  string
+	elapsed time.Duration
+}
+
+var (
+	timings    []stepTiming
+	skipped    int
+	timingLock sync.Mutex
+)
+
+// recordTiming notes that step finished building target, having started at
+// start. With -v the time is also printed as it happens.
+func recordTiming(step string, target string, start time.Time) {
+	elapsed := time.Since(start)
+	timingLock.Lock()
+	timings = append(timings, stepTiming{step, target, elapsed})
+	timingLock.Unlock()
+	if verbose {
+		logf(os.Stdout, "gb seven5: %s %s took %v\n", step, target, roundDuration(elapsed))
+	}
+}
+
+// recordSkip notes that target was up to date, so nothing was run for it.
+// Only -v lists each one; otherwise the summary just counts them.
+func recordSkip(target string) {
+	timingLock.Lock()
+	skipped++
+	timingLock.Unlock()
+	if verbose {
+		logAt(os.Stdout, severitySkipped, "gb seven5: %s is up to date\n", target)
+	}
+}
+
+// printTimingSummary prints the counts of pages compiled, generated and
+// found up to date since the last summary and the overall elapsed time;
+// with -v the slowest steps are listed too. The recorded timings are then
+// reset.
+func printTimingSummary(elapsed time.Duration) {
+	timingLock.Lock()
+	done, upToDate := timings, skipped
+	timings, skipped = nil, 0
+	timingLock.Unlock()
+
+	compiled, generated := 0, 0
+	for _, t := range done {
+		switch t.step {
+		case "gopherjs":
+			compiled++
+		case "pagegen":
+			generated++
+		}
+	}
+	if logFormat == "json" {
+		ms := elapsed.Nanoseconds() / int64(time.Millisecond)
+		emit(os.Stdout, logEvent{Event: "summary", DurationMS: &ms, Compiled: &compiled, Generated: &generated, UpToDate: &upToDate})
+		return
+	}
+	if verbose && len(done) > 0 {
+		sort.SliceStable(done, func(i, j int) bool { return done[i].elapsed > done[j].elapsed })
+		if len(done) > slowestSteps {
+			done = done[:slowestSteps]
+		}
+		logf(os.Stdout, "gb seven5: slowest steps:\n")
+		for _, t := range done {
+			logf(os.Stdout, "  %8v  %s %s\n", roundDuration(t.elapsed), t.step, t.target)
+		}
+	}
+	current := ""
+	if upToDate > 0 {
+		current = fmt.Sprintf(", %d up to date", upToDate)
+	}
+	logAt(os.Stdout, severityDone, "gb seven5: compiled %s, generated %s%s in %v\n",
+		plural(compiled, "page"), plural(generated, "html file"), current, roundDuration(elapsed))
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
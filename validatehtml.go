@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// validateHTML fails a page whose html is structurally broken.
+var validateHTML = false
+
+// voidElements have no content and so no end tag.
+var voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input",
+	"link", "meta", "param", "source", "track", "wbr"}
+
+// optionalEndElements may be left open; a parent's end tag, or the end of
+// the page, closes them.
+var optionalEndElements = []string{"html", "head", "body", "p", "li", "dt", "dd", "option",
+	"optgroup", "colgroup", "caption", "thead", "tbody", "tfoot", "tr", "td", "th", "rb", "rt", "rtc", "rp"}
+
+// rawContentElements hold text, not markup, up to their end tag.
+var rawContentElements = []string{"script", "style", "textarea", "title"}
+
+type openElement struct {
+	name   string
+	offset int
+}
+
+// checkHTML reports the first structural problem in page: an unterminated
+// tag or comment, an end tag that closes nothing or not the innermost open
+// element, or an element left open at the end. A browser would quietly
+// repair each of these, differently from what the template meant, so this
+// is stricter than an html parser; only the end tags html lets be left out
+// may be. The error gives the byte offset, and line, of the problem.
+func checkHTML(page []byte) error {
+	s := string(page)
+	stack := []openElement{}
+	at := func(offset int) string {
+		return fmt.Sprintf("offset %d (line %d)", offset, bytes.Count(page[:offset], []byte("\n"))+1)
+	}
+	for i := 0; i < len(s); {
+		lt := strings.IndexByte(s[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return fmt.Errorf("unterminated comment at %s", at(i))
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return fmt.Errorf("unterminated declaration at %s", at(i))
+			}
+			i += end + 1
+			continue
+		}
+		closing := strings.HasPrefix(rest, "</")
+		name := tagName(rest)
+		if closing {
+			name = tagName(rest[2:])
+		}
+		if name == "" || name[0] < 'a' || name[0] > 'z' {
+			i++ //a < in text, e.g. "a < b"
+			continue
+		}
+		tag := tagEnd(rest)
+		if !strings.HasSuffix(rest[:tag], ">") {
+			return fmt.Errorf("unterminated <%s tag at %s", name, at(i))
+		}
+		if closing {
+			if containsString(voidElements, name) {
+				i += tag
+				continue //</br> and the like are harmless
+			}
+			//end tags that may be left out are closed by their parent's
+			match := len(stack) - 1
+			for match >= 0 && stack[match].name != name && containsString(optionalEndElements, stack[match].name) {
+				match--
+			}
+			if match < 0 {
+				return fmt.Errorf("</%s> at %s closes no open element", name, at(i))
+			}
+			if stack[match].name != name {
+				return fmt.Errorf("</%s> at %s doesn't match <%s> opened at %s", name, at(i), stack[match].name, at(stack[match].offset))
+			}
+			stack = stack[:match]
+			i += tag
+			continue
+		}
+		opened := i
+		i += tag
+		if containsString(voidElements, name) || strings.HasSuffix(rest[:tag], "/>") {
+			continue
+		}
+		if containsString(rawContentElements, name) {
+			end := strings.Index(strings.ToLower(s[i:]), "</"+name)
+			if end < 0 {
+				return fmt.Errorf("<%s> opened at %s is never closed", name, at(opened))
+			}
+			i += end //its end tag is handled as any other
+		}
+		stack = append(stack, openElement{name, opened})
+	}
+	for j := len(stack) - 1; j >= 0; j-- {
+		if !containsString(optionalEndElements, stack[j].name) {
+			return fmt.Errorf("<%s> opened at %s is never closed", stack[j].name, at(stack[j].offset))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string //in the error, "" if the page is fine
+	}{
+		{"plain", "<!DOCTYPE html><html><body><div><p>hi</p></div></body></html>", ""},
+		{"void elements", "<div><br><img src=x><input type=text><meta charset=utf-8></div>", ""},
+		{"self closing", "<div><br/><span /></div>", ""},
+		{"void end tag", "<div><br></br></div>", ""},
+		{"script raw text", "<div><script>if (a < b && c > d) { s = '</div><b>'; }</script></div>", ""},
+		{"style raw text", "<style>p > a { content: '<i>'; }</style><p>x</p>", ""},
+		{"upper case raw end", "<script>x = 1</SCRIPT>", ""},
+		{"optional end tags", "<ul><li>one<li>two</ul><table><tr><td>a<td>b<tr><td>c</table><p>open", ""},
+		{"optional html body", "<html><head><title>t</title><body><p>x", ""},
+		{"comment", "<div><!-- </div> --></div>", ""},
+		{"less than in text", "<p>a < b</p>", ""},
+		{"attribute with >", `<a title="a > b" href="/">x</a>`, ""},
+		{"unclosed div", "<body><div><p>x</p></body>", "</body> at offset 19 (line 1) doesn't match <div>"},
+		{"never closed", "<div>\n<span>x</span>\n", "<div> opened at offset 0 (line 1) is never closed"},
+		{"mismatched", "<div><span>x</div></span>", "</div> at offset 12 (line 1) doesn't match <span>"},
+		{"stray end", "<p>x</p>\n</div>", "</div> at offset 9 (line 2) closes no open element"},
+		{"unterminated comment", "<div><!-- x", "unterminated comment"},
+		{"unterminated tag", "<div class='x'", "unterminated <div tag"},
+		{"unclosed script", "<script>var x = 1;", "<script> opened at offset 0 (line 1) is never closed"},
+	}
+	for _, test := range tests {
+		err := checkHTML([]byte(test.page))
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s: checkHTML = %v, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// version identifies this build of gb-seven5; release builds set it with
+// -ldflags "-X main.version=...".
+var version = "devel"
+
+// The oldest gopherjs and pagegen releases known to produce working output.
+// Bump these when the build starts to rely on something newer.
+const (
+	minGopherjsVersion = "1.17.0"
+	minPagegenVersion  = "0.1.0"
+)
+
+// printVersions reports the versions of this tool, gopherjs, and pagegen.
+// A tool that can't be run or queried is reported as unknown.
+func printVersions(project string) error {
+	fmt.Printf("gb-seven5 %s\n", version)
+	fmt.Printf("gopherjs %s\n", toolVersion(project, "gopherjs", "version"))
+	fmt.Printf("pagegen %s\n", toolVersion(project, "pagegen", "--version"))
+	return nil
+}
+
+func toolVersion(project string, name string, args ...string) string {
+	var out bytes.Buffer
+	env := gopherjsEnv(project)
+	if err := runWithTimeout(buildContext, toolPath(name), args, env, nil, &out, ioutil.Discard); err != nil {
+		return "unknown"
+	}
+	v := strings.TrimSpace(out.String())
+	if v == "" {
+		return "unknown"
+	}
+	//gopherjs prints "GopherJS 1.x.y", just keep the version part
+	if fields := strings.Fields(v); len(fields) == 2 && strings.EqualFold(fields[0], name) {
+		v = fields[1]
+	}
+	return v
+}
+
+// validateToolVersion fails if name reports a version older than min. A
+// tool whose version can't be determined gets a warning, not an error.
+func validateToolVersion(project string, name string, min string, args ...string) error {
+	v := toolVersion(project, name, args...)
+	older, ok := versionLess(v, min)
+	if !ok {
+		logAt(os.Stderr, severityWarning, "gb seven5: warning: unable to determine the version of %s (%s), need at least %s\n", name, v, min)
+		return nil
+	}
+	if older {
+		return fmt.Errorf("%s %s is too old, at least %s is required: please upgrade", name, v, min)
+	}
+	return nil
+}
+
+// versionLess reports whether version a is older than b, comparing the
+// dotted numeric release parts and ignoring any suffix such as "+go1.17.9"
+// or "-beta". The second result is false if either can't be parsed.
+func versionLess(a string, b string) (bool, bool) {
+	pa, ok := parseVersion(a)
+	if !ok {
+		return false, false
+	}
+	pb, ok := parseVersion(b)
+	if !ok {
+		return false, false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x < y, true
+		}
+	}
+	return false, true
+}
+
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "+- "); i >= 0 {
+		v = v[:i]
+	}
+	parts := []int{}
+	for _, field := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
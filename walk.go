@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// followSymlinks makes walkTree descend into symlinked directories.
+var followSymlinks = false
+
+// walkTree is filepath.Walk, except that with --follow-symlinks it also
+// walks the directories that symlinks under root point to, as if they were
+// there, e.g. a widgets package linked into several client trees. A
+// directory already walked, through a link or not, is not walked again,
+// which also keeps a link to an ancestor from looping forever. As with
+// filepath.Walk, fn is passed a nil info along with the error for a path
+// that can't be read.
+func walkTree(root string, fn filepath.WalkFunc) error {
+	if !followSymlinks {
+		return filepath.Walk(root, fn)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollowing(root, info, fn, &visitedDirs{keys: map[fileKey]bool{}})
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// visitedDirs are the directories walkFollowing has walked, by device and
+// inode where the platform has them, otherwise in a list checked with
+// os.SameFile.
+type visitedDirs struct {
+	keys  map[fileKey]bool
+	infos []os.FileInfo
+}
+
+// visit records info and reports whether it was walked before.
+func (v *visitedDirs) visit(info os.FileInfo) bool {
+	if key, ok := keyOf(info); ok {
+		if v.keys[key] {
+			return true
+		}
+		v.keys[key] = true
+		return false
+	}
+	for _, seen := range v.infos {
+		if os.SameFile(seen, info) {
+			return true
+		}
+	}
+	v.infos = append(v.infos, info)
+	return false
+}
+
+func walkFollowing(path string, info os.FileInfo, fn filepath.WalkFunc, visited *visitedDirs) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	if visited.visit(info) {
+		return nil
+	}
+	if err := fn(path, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return fn(path, info, err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		childInfo, err := os.Stat(child)
+		if err != nil {
+			//a dangling link is just a file that can't be followed
+			if childInfo, err = os.Lstat(child); err != nil {
+				if err := fn(child, nil, err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+		}
+		if err := walkFollowing(child, childInfo, fn, visited); err != nil {
+			if err == filepath.SkipDir {
+				return nil //returned for a file: skip the rest of path
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "os"
+
+// fileKey is empty where os.FileInfo has no device and inode, leaving
+// visitedDirs to compare with os.SameFile.
+type fileKey struct{}
+
+func keyOf(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkTreeMissingRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "missing")
+	for _, follow := range []bool{false, true} {
+		followSymlinks = follow
+		walked := 0
+		err := walkTree(root, func(path string, info os.FileInfo, err error) error {
+			walked++
+			if info != nil || err == nil {
+				t.Errorf("follow %v: walk func given info %v, error %v for a missing root", follow, info, err)
+			}
+			return err
+		})
+		if !os.IsNotExist(err) {
+			t.Errorf("follow %v: walkTree = %v, want not exist", follow, err)
+		}
+		if walked != 1 {
+			t.Errorf("follow %v: walk func called %d times", follow, walked)
+		}
+	}
+	followSymlinks = false
+}
+
+func TestWalkTreeUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"about.go":          "package main\n",
+		"private/secret.go": "package main\n",
+	})
+	private := filepath.Join(dir, "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0755)
+	for _, follow := range []bool{false, true} {
+		followSymlinks = follow
+		if _, err := iterateDirs(nil, []string{dir}); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("follow %v: iterateDirs = %v, want a permission error", follow, err)
+		}
+	}
+	followSymlinks = false
+}
+
+func TestIgnoreSkipWithoutInfo(t *testing.T) {
+	rules := &ignoreRules{root: "/p", rules: []ignoreRule{{segments: []string{"*"}}}}
+	if skip, err := rules.skip("/p/gone.go", nil); skip || err != nil {
+		t.Errorf("skip with nil info = %v, %v, want false, nil", skip, err)
+	}
+}
+
+func TestWalkTreeFollowsLinksOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"client/about.go":       "package main\n",
+		"shared/widgets/tab.go": "package widgets\n",
+	})
+	links := map[string]string{
+		"client/widgets": filepath.Join(dir, "shared", "widgets"),
+		"client/again":   filepath.Join(dir, "shared", "widgets"),
+		"client/loop":    filepath.Join(dir, "client"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+	followSymlinks = true
+	defer func() { followSymlinks = false }()
+	walked := map[string]int{}
+	err := walkTree(filepath.Join(dir, "client"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			walked[filepath.Base(path)]++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walked["about.go"] != 1 || walked["tab.go"] != 1 || len(walked) != 2 {
+		t.Errorf("walked %v, want about.go and tab.go once each", walked)
+	}
+}
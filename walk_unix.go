@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileKey identifies a file by device and inode.
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+func keyOf(info os.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{uint64(stat.Dev), uint64(stat.Ino)}, true
+}
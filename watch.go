@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often the source trees are polled; a change is only
+// acted on once a full interval passes without further changes, so an
+// editor saving several files at once triggers a single rebuild.
+const watchInterval = 200 * time.Millisecond
+
+// snapshot maps each watched file to its modification time and size.
+type snapshot map[string]fileState
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchPackages polls the client and templates trees of each package and
+// rebuilds the affected step whenever a source, template or data file changes.
+// It returns when the build is cancelled by SIGINT or SIGTERM. The
+// pre-build hook isn't rerun: the sources it writes would trigger another
+// rebuild, and so on forever.
+//
+// Polling, rather than fsnotify, keeps the plugin to the standard library;
+// each tick re-walks the trees, which is cheap next to a gopherjs compile.
+func watchPackages(project string, args []string) error {
+	previous := map[string]snapshot{}
+	for _, arg := range args {
+		previous[arg] = takeSnapshot(project, arg)
+	}
+	logf(os.Stdout, "gb seven5: watching %s for changes (ctrl-c to stop)\n", strings.Join(args, ", "))
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	batch := &debouncer{}
+	for {
+		select {
+		case <-buildContext.Done():
+			logf(os.Stdout, "gb seven5: stopped watching\n")
+			return nil
+		case <-ticker.C:
+		}
+		changes := map[string][]string{}
+		for _, arg := range args {
+			current := takeSnapshot(project, arg)
+			changes[arg] = diffSnapshots(previous[arg], current)
+			previous[arg] = current
+		}
+		ready := batch.observe(changes)
+		if ready == nil {
+			continue
+		}
+		for _, arg := range args {
+			if changed, ok := ready[arg]; ok {
+				rebuildChanged(project, arg, changed)
+			}
+		}
+		if afterRebuild != nil {
+			afterRebuild()
+		}
+	}
+}
+
+// debouncer holds the changes found by successive polls, by package, until
+// a poll finds none.
+type debouncer struct {
+	pending map[string][]string
+}
+
+// observe adds the changes one poll found and returns everything pending
+// once a poll is quiet, or nil while changes are still coming in or there
+// are none.
+func (d *debouncer) observe(changes map[string][]string) map[string][]string {
+	quiet := true
+	for arg, changed := range changes {
+		if len(changed) == 0 {
+			continue
+		}
+		if d.pending == nil {
+			d.pending = map[string][]string{}
+		}
+		d.pending[arg] = append(d.pending[arg], changed...)
+		quiet = false
+	}
+	if !quiet || len(d.pending) == 0 {
+		return nil
+	}
+	ready := d.pending
+	d.pending = nil
+	return ready
+}
+
+func takeSnapshot(project string, arg string) snapshot {
+	snap := snapshot{}
+	roots := append([]string{constructClientPackagePath(project, arg)}, constructTemplateRoots(project, arg)...)
+	ignore := ignoresFor(project, arg)
+	for _, root := range roots {
+		walkTree(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil //files can vanish mid-walk while editing
+			}
+			if skip, err := ignore.skip(path, info); skip {
+				return err
+			}
+			if info.IsDir() || !isWatchedFile(path) {
+				return nil
+			}
+			snap[path] = fileState{info.ModTime(), info.Size()}
+			return nil
+		})
+	}
+	return snap
+}
+
+func isWatchedFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".go", ".html", ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// diffSnapshots returns the files that were added, removed, or modified.
+func diffSnapshots(before, after snapshot) []string {
+	changed := []string{}
+	for path, state := range after {
+		if old, ok := before[path]; !ok || old != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
+
+// rebuildChanged re-runs only the steps affected by the changed files. A go
+// file change recompiles the pages that depend on it when that can be
+// determined, otherwise the whole client package; template and data changes
+// re-run page generation, which skips pages that are already current.
+func rebuildChanged(project string, arg string, changed []string) {
+	start := time.Now()
+	goChanged := []string{}
+	templatesChanged := false
+	for _, path := range changed {
+		logf(os.Stdout, "gb seven5: changed %s\n", path)
+		if strings.HasSuffix(path, ".go") {
+			goChanged = append(goChanged, path)
+		} else if strings.HasSuffix(path, pageOptionsSuffix) {
+			//a page's own options change what it compiles to
+			goChanged = append(goChanged, strings.TrimSuffix(path, pageOptionsSuffix)+".go")
+		} else {
+			templatesChanged = true
+		}
+	}
+	//new fingerprints, or inlined javascript, have to be written into
+	//the pages
+	if len(goChanged) > 0 && (fingerprint || inlineJS) {
+		templatesChanged = true
+	}
+	langs, err := languagesFor(project, arg)
+	if err != nil {
+		return
+	}
+	forEachLanguage(langs, func(lang string) error {
+		if len(goChanged) > 0 {
+			if err := recompileDependents(project, arg, lang, goChanged); err != nil {
+				logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+			}
+		}
+		if templatesChanged {
+			if err := pageGeneration(project, arg, lang); err != nil {
+				logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+			} else if sitemapBase != "" {
+				if err := writeSitemap(project, arg, lang, sitemapBase); err != nil {
+					logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+				}
+			}
+		}
+		return nil //one language failing doesn't stop the others
+	})
+	if hook := hookCommand(postBuild, config.PostBuild); hook != "" {
+		if err := runHook(project, arg, langs[0], "post-build", hook); err != nil {
+			logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+		}
+	}
+	if compress {
+		if err := compressOutputs(project, arg); err != nil {
+			logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+		}
+	}
+	if err := writeManifest(project, arg); err != nil {
+		logf(os.Stderr, "gb seven5: %s: %v\n", arg, err)
+	}
+	printTimingSummary(time.Since(start))
+	warnCommonImports()
+}
+
+func recompileDependents(project string, arg string, lang string, goChanged []string) error {
+	gofiles, err := iterateDirs(ignoresFor(project, arg), []string{constructClientPackagePath(project, arg)})
+	if err != nil {
+		return err
+	}
+	pages, err := findPages(gofiles)
+	if err != nil {
+		return err
+	}
+	affected := []string{}
+	for _, page := range pages {
+		dirs := map[string]bool{}
+		sources := pageSources(page)
+		for _, source := range sources {
+			if err := collectImportDirs(project, source, dirs); err != nil {
+				//can't tell what this page depends on, so rebuild everything
+				return compilePages(project, arg, lang, pages)
+			}
+		}
+		for _, path := range goChanged {
+			if containsString(sources, path) || dirs[filepath.Dir(path)] {
+				affected = append(affected, page)
+				break
+			}
+		}
+	}
+	if len(affected) == 0 {
+		return compilePages(project, arg, lang, pages)
+	}
+	return compilePages(project, arg, lang, affected)
+}
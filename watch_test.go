@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := time.Unix(1001, 0)
+	tests := []struct {
+		name          string
+		before, after snapshot
+		want          []string
+	}{
+		{"unchanged", snapshot{"a.go": {t0, 1}}, snapshot{"a.go": {t0, 1}}, []string{}},
+		{"added", snapshot{}, snapshot{"a.go": {t0, 1}}, []string{"a.go"}},
+		{"removed", snapshot{"a.go": {t0, 1}}, snapshot{}, []string{"a.go"}},
+		{"newer", snapshot{"a.go": {t0, 1}}, snapshot{"a.go": {t1, 1}}, []string{"a.go"}},
+		{"resized", snapshot{"a.go": {t0, 1}}, snapshot{"a.go": {t0, 2}}, []string{"a.go"}},
+		{"some of several",
+			snapshot{"a.go": {t0, 1}, "b.json": {t0, 1}, "c.html": {t0, 1}},
+			snapshot{"a.go": {t0, 1}, "b.json": {t1, 1}, "d.html": {t0, 1}},
+			[]string{"b.json", "c.html", "d.html"}},
+	}
+	for _, test := range tests {
+		got := diffSnapshots(test.before, test.after)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	type poll struct {
+		changes map[string][]string
+		want    map[string][]string
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{"nothing changes", []poll{
+			{map[string][]string{"site": nil}, nil},
+			{map[string][]string{"site": nil}, nil},
+		}},
+		{"one change waits for a quiet poll", []poll{
+			{map[string][]string{"site": {"a.go"}}, nil},
+			{map[string][]string{"site": nil}, map[string][]string{"site": {"a.go"}}},
+			{map[string][]string{"site": nil}, nil},
+		}},
+		{"a burst is one batch", []poll{
+			{map[string][]string{"site": {"a.go"}}, nil},
+			{map[string][]string{"site": {"b.html"}, "blog": {"c.json"}}, nil},
+			{map[string][]string{"site": {"a.go"}}, nil},
+			{map[string][]string{"site": nil, "blog": nil},
+				map[string][]string{"site": {"a.go", "b.html", "a.go"}, "blog": {"c.json"}}},
+		}},
+		{"batches after a quiet poll are separate", []poll{
+			{map[string][]string{"site": {"a.go"}}, nil},
+			{map[string][]string{}, map[string][]string{"site": {"a.go"}}},
+			{map[string][]string{"site": {"b.go"}}, nil},
+			{map[string][]string{}, map[string][]string{"site": {"b.go"}}},
+		}},
+	}
+	for _, test := range tests {
+		d := &debouncer{}
+		for i, p := range test.polls {
+			if got := d.observe(p.changes); !reflect.DeepEqual(got, p.want) {
+				t.Errorf("%s: poll %d: got %v, want %v", test.name, i, got, p.want)
+			}
+		}
+	}
+}
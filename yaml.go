@@ -0,0 +1,541 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseYAML converts the YAML document in data to the values json.Marshal
+// understands: map[string]interface{}, []interface{}, string, bool, int64,
+// float64 and nil. It handles the subset of YAML that page data needs --
+// block mappings and sequences, comments, plain and quoted scalars,
+// literal (|) and folded (>) block scalars, and single line flow
+// collections -- and rejects anchors, aliases, and tags.
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+	indent, content, ok := p.peek()
+	if err := p.checkTabs(); err != nil {
+		return nil, err
+	}
+	if ok && (content == "---" || strings.HasPrefix(content, "--- ")) {
+		if rest := strings.TrimSpace(strings.TrimPrefix(content, "---")); rest != "" {
+			return nil, p.errorf("content after the document marker is not supported")
+		}
+		p.pos++
+		indent, content, ok = p.peek()
+	}
+	if !ok {
+		return nil, nil
+	}
+	value, err := p.parseNode(indent)
+	if err != nil {
+		return nil, err
+	}
+	if _, content, ok = p.peek(); ok {
+		return nil, p.errorf("unexpected content %q", content)
+	}
+	return value, nil
+}
+
+// yamlError carries the 1-based line a problem was found on.
+type yamlError struct {
+	line int
+	msg  string
+}
+
+func (e *yamlError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return &yamlError{p.pos + 1, fmt.Sprintf(format, args...)}
+}
+
+// peek skips blank and comment-only lines and returns the indentation and
+// the comment-stripped content of the next line, without consuming it. The
+// document ends at a "..." line.
+func (p *yamlParser) peek() (int, string, bool) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		content := strings.TrimSpace(stripYAMLComment(line))
+		if content == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.HasPrefix(line[indent:], "\t") || indent == 0 && content == "..." {
+			return 0, "", false
+		}
+		return indent, content, true
+	}
+	return 0, "", false
+}
+
+func (p *yamlParser) checkTabs() error {
+	if p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "\t") && strings.TrimSpace(line) != "" {
+			return p.errorf("tabs can't be used for indentation")
+		}
+	}
+	return nil
+}
+
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	_, content, ok := p.peek()
+	if err := p.checkTabs(); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	if content == "-" || strings.HasPrefix(content, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, isKey := splitYAMLKey(content); isKey {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	value, err := parseYAMLScalar(content)
+	if err != nil {
+		return nil, p.errorAt(p.pos-1, err)
+	}
+	return value, nil
+}
+
+func (p *yamlParser) errorAt(pos int, err error) error {
+	return &yamlError{pos + 1, err.Error()}
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	result := map[string]interface{}{}
+	for {
+		lineIndent, content, ok := p.peek()
+		if err := p.checkTabs(); err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent {
+			return result, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, isKey := splitYAMLKey(content)
+		if !isKey {
+			return nil, p.errorf("expected a key: value pair, found %q", content)
+		}
+		name, err := parseYAMLKey(key)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := result[name]; dup {
+			return nil, p.errorf("duplicate key %q", name)
+		}
+		value, err := p.parseValue(indent, rest, true)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = value
+	}
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	result := []interface{}{}
+	for {
+		lineIndent, content, ok := p.peek()
+		if err := p.checkTabs(); err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent {
+			return result, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if content != "-" && !strings.HasPrefix(content, "- ") {
+			return result, nil
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(content, "-"))
+		if _, _, isKey := splitYAMLKey(rest); isKey || rest == "-" || strings.HasPrefix(rest, "- ") {
+			//the entry is a collection that starts on the dash's line;
+			//re-read the line as if the dash were indentation
+			line := p.lines[p.pos]
+			offset := strings.Index(line, "-") + 1
+			offset += len(line[offset:]) - len(strings.TrimLeft(line[offset:], " "))
+			p.lines[p.pos] = strings.Repeat(" ", offset) + line[offset:]
+			value, err := p.parseNode(offset)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+			continue
+		}
+		value, err := p.parseValue(indent, rest, false)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+}
+
+// parseValue parses what follows a key or a dash on the current line,
+// which may be nothing (a nested collection follows), a block scalar
+// header, or an inline scalar.
+func (p *yamlParser) parseValue(indent int, rest string, inMapping bool) (interface{}, error) {
+	line := p.pos
+	p.pos++
+	if rest == "" {
+		nextIndent, content, ok := p.peek()
+		if !ok || nextIndent < indent {
+			return nil, nil
+		}
+		//a sequence may sit at its key's indentation
+		if nextIndent == indent {
+			if inMapping && (content == "-" || strings.HasPrefix(content, "- ")) {
+				return p.parseSequence(indent)
+			}
+			return nil, nil
+		}
+		return p.parseNode(nextIndent)
+	}
+	if rest[0] == '|' || rest[0] == '>' {
+		return p.parseBlockScalar(indent, rest)
+	}
+	value, err := parseYAMLScalar(rest)
+	if err != nil {
+		return nil, p.errorAt(line, err)
+	}
+	if nextIndent, _, ok := p.peek(); ok && nextIndent > indent {
+		return nil, p.errorf("multi-line plain scalars are not supported, use | or >")
+	}
+	return value, nil
+}
+
+func (p *yamlParser) parseBlockScalar(indent int, header string) (interface{}, error) {
+	literal := header[0] == '|'
+	chomp := strings.TrimSpace(header[1:])
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorAt(p.pos-1, fmt.Errorf("unsupported block scalar header %q", header))
+	}
+	lines := []string{}
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			return nil, p.errorf("block scalar line is less indented than the first line")
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	//trailing blank lines belong to chomping, not to the content
+	body := lines
+	trailing := 0
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+		trailing++
+	}
+	var text string
+	if literal {
+		text = strings.Join(body, "\n")
+	} else {
+		text = foldYAMLLines(body)
+	}
+	switch {
+	case len(body) == 0:
+		text = ""
+	case chomp == "-":
+	case chomp == "+":
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// foldYAMLLines joins the lines of a folded block scalar: single line breaks
+// become spaces, blank lines become line breaks in place of the one before
+// them, and the breaks around more indented lines are kept as they are.
+func foldYAMLLines(lines []string) string {
+	var b strings.Builder
+	last := -1 //the last line with content
+	for i, line := range lines {
+		if line == "" {
+			b.WriteString("\n")
+			continue
+		}
+		if last >= 0 {
+			indented := strings.HasPrefix(line, " ") || strings.HasPrefix(lines[last], " ")
+			switch {
+			case indented:
+				b.WriteString("\n")
+			case last == i-1:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(line)
+		last = i
+	}
+	return b.String()
+}
+
+// stripYAMLComment removes a trailing comment, i.e. a # at the start of the
+// line or after whitespace that isn't inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '\'' && c == '\'' && i+1 < len(line) && line[i+1] == '\'':
+			i++ //'' is a quote inside a single quoted string
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t:[{,-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitYAMLKey splits "key: value" (or "key:") at the first colon outside
+// quotes that is followed by a space or ends the line.
+func splitYAMLKey(content string) (string, string, bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '\'' && c == '\'' && i+1 < len(content) && content[i+1] == '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '[' || c == '{':
+			if i == 0 || depth > 0 {
+				depth++
+			}
+		case (c == ']' || c == '}') && depth > 0:
+			depth--
+		case c == ':' && depth == 0 && (i == len(content)-1 || content[i+1] == ' '):
+			return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func parseYAMLKey(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	if key[0] == '"' || key[0] == '\'' {
+		value, rest, err := parseYAMLQuoted(key)
+		if err != nil {
+			return "", err
+		}
+		if rest != "" {
+			return "", fmt.Errorf("unexpected %q after quoted key", rest)
+		}
+		return value.(string), nil
+	}
+	if strings.ContainsAny(key[:1], "[{&*!?|>%@`") {
+		return "", fmt.Errorf("unsupported key %q", key)
+	}
+	return key, nil
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// parseYAMLScalar parses an inline value: a quoted or plain scalar, or a
+// flow sequence or mapping.
+func parseYAMLScalar(s string) (interface{}, error) {
+	value, rest, err := parseYAMLFlow(s, false)
+	if err != nil {
+		return nil, err
+	}
+	if rest := strings.TrimSpace(rest); rest != "" {
+		return nil, fmt.Errorf("unexpected %q after value", rest)
+	}
+	return value, nil
+}
+
+// parseYAMLFlow parses one value from the start of s, returning the
+// unparsed remainder. Inside a flow collection plain scalars end at a
+// comma or closing bracket.
+func parseYAMLFlow(s string, inFlow bool) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return nil, "", nil
+	}
+	switch s[0] {
+	case '"', '\'':
+		return parseYAMLQuoted(s)
+	case '[':
+		return parseYAMLFlowSequence(s[1:])
+	case '{':
+		return parseYAMLFlowMapping(s[1:])
+	case '&', '*', '!':
+		return nil, "", fmt.Errorf("yaml anchors, aliases, and tags are not supported")
+	case '|', '>':
+		return nil, "", fmt.Errorf("unexpected %c, block scalars must follow a key or dash", s[0])
+	}
+	end := len(s)
+	if inFlow {
+		if i := strings.IndexAny(s, ",]}"); i >= 0 {
+			end = i
+		}
+		//a colon followed by a space ends a flow mapping key
+		if i := strings.Index(s[:end], ": "); i >= 0 {
+			end = i
+		}
+	}
+	return plainYAMLValue(strings.TrimSpace(s[:end])), s[end:], nil
+}
+
+func plainYAMLValue(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlInt.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+func parseYAMLQuoted(s string) (interface{}, string, error) {
+	quote := s[0]
+	if quote == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				return b.String(), s[i+1:], nil
+			}
+			b.WriteByte(s[i])
+		}
+		return nil, "", fmt.Errorf("unterminated single quoted string")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return nil, "", fmt.Errorf("bad double quoted string %s: %v", s[:i+1], err)
+			}
+			return value, s[i+1:], nil
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated double quoted string")
+}
+
+func parseYAMLFlowSequence(s string) (interface{}, string, error) {
+	result := []interface{}{}
+	s = strings.TrimLeft(s, " ")
+	if strings.HasPrefix(s, "]") {
+		return result, s[1:], nil
+	}
+	for {
+		value, rest, err := parseYAMLFlow(s, true)
+		if err != nil {
+			return nil, "", err
+		}
+		result = append(result, value)
+		rest = strings.TrimLeft(rest, " ")
+		switch {
+		case strings.HasPrefix(rest, ","):
+			s = rest[1:]
+		case strings.HasPrefix(rest, "]"):
+			return result, rest[1:], nil
+		default:
+			return nil, "", fmt.Errorf("unterminated flow sequence")
+		}
+	}
+}
+
+func parseYAMLFlowMapping(s string) (interface{}, string, error) {
+	result := map[string]interface{}{}
+	s = strings.TrimLeft(s, " ")
+	if strings.HasPrefix(s, "}") {
+		return result, s[1:], nil
+	}
+	for {
+		key, rest, err := parseYAMLFlow(s, true)
+		if err != nil {
+			return nil, "", err
+		}
+		name, ok := key.(string)
+		if !ok {
+			name = fmt.Sprint(key)
+		}
+		rest = strings.TrimLeft(rest, " ")
+		if !strings.HasPrefix(rest, ":") {
+			return nil, "", fmt.Errorf("expected : after key %q in flow mapping", name)
+		}
+		value, rest, err := parseYAMLFlow(rest[1:], true)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, dup := result[name]; dup {
+			return nil, "", fmt.Errorf("duplicate key %q", name)
+		}
+		result[name] = value
+		rest = strings.TrimLeft(rest, " ")
+		switch {
+		case strings.HasPrefix(rest, ","):
+			s = rest[1:]
+		case strings.HasPrefix(rest, "}"):
+			return result, rest[1:], nil
+		default:
+			return nil, "", fmt.Errorf("unterminated flow mapping")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type yamlMap = map[string]interface{}
+type yamlList = []interface{}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want interface{}
+	}{
+		{"empty", "", nil},
+		{"scalars", "title: Home\ncount: 3\nratio: 1.5\ndraft: false\nnothing: null\n",
+			yamlMap{"title": "Home", "count": int64(3), "ratio": 1.5, "draft": false, "nothing": nil}},
+		{"nested maps", "site:\n  title: Home\n  owner:\n    name: Ann\n",
+			yamlMap{"site": yamlMap{"title": "Home", "owner": yamlMap{"name": "Ann"}}}},
+		{"lists", "tags:\n  - go\n  - web\nlinks:\n- href: /\n  text: home\n- href: /about\n",
+			yamlMap{"tags": yamlList{"go", "web"},
+				"links": yamlList{yamlMap{"href": "/", "text": "home"}, yamlMap{"href": "/about"}}}},
+		{"top level list", "- 1\n- two\n", yamlList{int64(1), "two"}},
+		{"flow", "tags: [go, web]\nsize: {w: 1, h: 2}\n",
+			yamlMap{"tags": yamlList{"go", "web"}, "size": yamlMap{"w": int64(1), "h": int64(2)}}},
+		{"literal block", "body: |\n  one\n  two\nafter: x\n",
+			yamlMap{"body": "one\ntwo\n", "after": "x"}},
+		{"folded block", "body: >\n  one\n  two\n\n  three\n",
+			yamlMap{"body": "one two\nthree\n"}},
+		{"folded indented lines", "body: >\n  one\n    two\n\n    three\n  four\n",
+			yamlMap{"body": "one\n  two\n\n  three\nfour\n"}},
+		{"stripped block", "body: |-\n  one\n", yamlMap{"body": "one"}},
+		{"double quoted", `title: "a \"b\"\tc\né"` + "\n", yamlMap{"title": "a \"b\"\tc\né"}},
+		{"single quoted", "title: 'it''s # not a comment'\n", yamlMap{"title": "it's # not a comment"}},
+		{"quoted number", "zip: \"02134\"\n", yamlMap{"zip": "02134"}},
+		{"comments", "# heading\ntitle: Home # trailing\n\n  # indented\nurl: http://x/#top\n",
+			yamlMap{"title": "Home", "url": "http://x/#top"}},
+		{"document markers", "---\ntitle: Home\n...\n", yamlMap{"title": "Home"}},
+	}
+	for _, test := range tests {
+		got, err := parseYAML([]byte(test.doc))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseYAML = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		line int
+	}{
+		{"tab indent", "site:\n\ttitle: Home\n", 2},
+		{"bad indent", "site:\n    title: Home\n  owner: Ann\n", 3},
+		{"duplicate key", "title: a\ntitle: b\n", 2},
+		{"unterminated quote", "ok: 1\ntitle: \"Home\n", 2},
+		{"anchor", "a: 1\nb: &x 2\n", 2},
+		{"alias", "a: 1\nb: *x\n", 2},
+		{"list in map", "title: Home\n- item\n", 2},
+		{"unclosed flow", "a: 1\n\ntags: [go, web\n", 3},
+	}
+	for _, test := range tests {
+		_, err := parseYAML([]byte(test.doc))
+		yamlErr, ok := err.(*yamlError)
+		if !ok {
+			t.Errorf("%s: parseYAML error %v, want a yamlError", test.name, err)
+			continue
+		}
+		if yamlErr.line != test.line {
+			t.Errorf("%s: error on line %d (%s), want line %d", test.name, yamlErr.line, yamlErr.msg, test.line)
+		}
+	}
+}